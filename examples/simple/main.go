@@ -13,6 +13,8 @@ func main() {
 	buildgo.Setup()
 	defer buildgo.Cleanup()
 
+	ctx := context.Background()
+
 	fp, err := filepath.Abs(".")
 	if err != nil {
 		panic(err)
@@ -25,7 +27,12 @@ func main() {
 			panic(err)
 		}
 		firstStep = buildgo.NewStep("First step", cmd)
-		firstStep.AddFileDeps("read_file/file.txt")
+
+		// Tracks read_file/main.go, the embedded read_file/file.txt and go.mod.
+		err = cmdgo.AddFileDeps(ctx, firstStep, cmd)
+		if err != nil {
+			panic(err)
+		}
 	}
 
 	var second *buildgo.Step
@@ -39,8 +46,7 @@ func main() {
 		second.DependsOn(firstStep)
 	}
 
-	err = second.Run(context.Background())
-	if err != nil {
-		panic(err)
-	}
+	// Runs the steps named on the command line, or all of them, e.g.
+	// go run . -output=grouped "Second step"
+	buildgo.Main(second)
 }
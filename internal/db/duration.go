@@ -0,0 +1,43 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// GetDurations returns the typical duration of each step which has run
+// successfully before.
+func GetDurations(db *sql.DB) (durations map[string]time.Duration, err error) {
+	const stmt = "SELECT step_name, duration FROM durations"
+	rows, err := db.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	durations = map[string]time.Duration{}
+	for rows.Next() {
+		var (
+			step string
+			d    int64
+		)
+		err = rows.Scan(&step, &d)
+		if err != nil {
+			return nil, err
+		}
+		durations[step] = time.Duration(d)
+	}
+
+	return durations, rows.Err()
+}
+
+// AddDuration adds the duration of a successful run of the given step. The
+// stored duration is a moving average, weighted towards recent runs.
+func AddDuration(db *sql.DB, step string, d time.Duration) error {
+	const stmt = `INSERT INTO durations (step_name, duration, runs) VALUES (?, ?, 1)
+ON CONFLICT (step_name) DO UPDATE SET
+    duration = CAST(duration * 0.7 + excluded.duration * 0.3 AS INTEGER),
+    runs     = runs + 1`
+	_, err := db.Exec(stmt, step, int64(d))
+	return err
+}
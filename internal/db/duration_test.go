@@ -0,0 +1,25 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestAddDuration(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDb(t)
+
+	err := AddDuration(db, "build", 10*time.Second)
+	test.NilErr(t, err)
+	err = AddDuration(db, "build", 20*time.Second)
+	test.NilErr(t, err)
+
+	durations, err := GetDurations(db)
+	test.NilErr(t, err)
+	test.AssertEqual(t, "Expected moving average", map[string]time.Duration{
+		"build": 13 * time.Second,
+	}, durations)
+}
@@ -26,3 +26,25 @@ func SetHash(db *sql.DB, fp string, h []byte) error {
 	_, err := db.Exec(stmt, fp, h)
 	return err
 }
+
+// GetFingerprint returns the fingerprint for the given step.
+func GetFingerprint(db *sql.DB, step string) (h []byte, err error) {
+	const stmt = "SELECT hash FROM fingerprints WHERE step_name = ?"
+	err = db.QueryRow(stmt, step).Scan(&h)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// SetFingerprint sets the fingerprint for the given step.
+func SetFingerprint(db *sql.DB, step string, h []byte) error {
+	const stmt = "INSERT OR REPLACE INTO fingerprints (step_name, hash) VALUES (?, ?)"
+	_, err := db.Exec(stmt, step, h)
+	return err
+}
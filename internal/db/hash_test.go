@@ -54,3 +54,21 @@ func TestOverwriteHash(t *testing.T) {
 
 	test.AssertEqual(t, "Expected hash to be equal", h2, hRes)
 }
+
+func TestGetSetFingerprint(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDb(t)
+
+	h, err := GetFingerprint(db, "build")
+	test.NilErr(t, err)
+	test.AssertEqual(t, "Expected fingerprint to be nil", nil, h)
+
+	h1 := sha256.New().Sum([]byte("test"))
+	err = SetFingerprint(db, "build", h1)
+	test.NilErr(t, err)
+
+	h, err = GetFingerprint(db, "build")
+	test.NilErr(t, err)
+	test.AssertEqual(t, "Expected fingerprint to be equal", h1, h)
+}
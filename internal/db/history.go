@@ -0,0 +1,150 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Build represents a recorded build.
+type Build struct {
+	ID      string
+	Start   time.Time
+	End     time.Time
+	Roots   []string
+	Outcome string
+}
+
+// BuildStep represents the outcome of a step in a recorded build.
+type BuildStep struct {
+	Name     string
+	Status   string
+	Start    time.Time
+	Duration time.Duration
+	// Reason is why the step was run or skipped.
+	Reason   string
+	Attempts int
+	// ExitCode is the exit code of the failing command, 0 if the step did not
+	// fail and -1 if the failure had no exit code.
+	ExitCode int
+}
+
+// AddBuild records a build and the outcome of its steps, removing all but the
+// keep most recent builds.
+func AddBuild(db *sql.DB, build Build, steps []BuildStep, keep int) (err error) {
+	roots, err := json.Marshal(build.Roots)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const buildStmt = `INSERT INTO builds (id, start_time, end_time, roots, outcome)
+VALUES (?, ?, ?, ?, ?)`
+	_, err = tx.Exec(buildStmt, build.ID, build.Start.UnixNano(), build.End.UnixNano(), string(roots), build.Outcome)
+	if err != nil {
+		return err
+	}
+
+	const stepStmt = `INSERT INTO build_steps
+    (build_id, step_name, status, start_time, duration, reason, attempts, exit_code)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	for _, s := range steps {
+		var start int64
+		if !s.Start.IsZero() {
+			start = s.Start.UnixNano()
+		}
+		_, err = tx.Exec(stepStmt, build.ID, s.Name, s.Status, start, int64(s.Duration), s.Reason, s.Attempts, s.ExitCode)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Foreign keys are not enforced, so the steps are removed explicitly.
+	const pruneStepsStmt = `DELETE FROM build_steps WHERE build_id IN
+    (SELECT id FROM builds ORDER BY start_time DESC LIMIT -1 OFFSET ?)`
+	_, err = tx.Exec(pruneStepsStmt, keep)
+	if err != nil {
+		return err
+	}
+	const pruneStmt = `DELETE FROM builds WHERE id IN
+    (SELECT id FROM builds ORDER BY start_time DESC LIMIT -1 OFFSET ?)`
+	_, err = tx.Exec(pruneStmt, keep)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetBuilds returns the most recent builds, newest first.
+func GetBuilds(db *sql.DB, limit int) (builds []Build, err error) {
+	const stmt = `SELECT id, start_time, end_time, roots, outcome FROM builds
+ORDER BY start_time DESC
+LIMIT ?`
+	rows, err := db.Query(stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			b          Build
+			start, end int64
+			roots      string
+		)
+		err = rows.Scan(&b.ID, &start, &end, &roots, &b.Outcome)
+		if err != nil {
+			return nil, err
+		}
+		b.Start = time.Unix(0, start)
+		b.End = time.Unix(0, end)
+		err = json.Unmarshal([]byte(roots), &b.Roots)
+		if err != nil {
+			return nil, err
+		}
+		builds = append(builds, b)
+	}
+
+	return builds, rows.Err()
+}
+
+// GetStepRuns returns the runs of each step which ran in the most recent
+// builds, newest first, keyed by step name. Skipped steps are left out, as
+// their durations say nothing about the step.
+func GetStepRuns(db *sql.DB, builds int) (runs map[string][]BuildStep, err error) {
+	const stmt = `SELECT s.step_name, s.status, s.start_time, s.duration, s.reason, s.attempts, s.exit_code
+FROM build_steps s
+JOIN (SELECT id, start_time FROM builds ORDER BY start_time DESC LIMIT ?) b ON b.id = s.build_id
+WHERE s.status IN ('succeeded', 'failed')
+ORDER BY b.start_time DESC`
+	rows, err := db.Query(stmt, builds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs = map[string][]BuildStep{}
+	for rows.Next() {
+		var (
+			s            BuildStep
+			start, durNs int64
+		)
+		err = rows.Scan(&s.Name, &s.Status, &start, &durNs, &s.Reason, &s.Attempts, &s.ExitCode)
+		if err != nil {
+			return nil, err
+		}
+		if start != 0 {
+			s.Start = time.Unix(0, start)
+		}
+		s.Duration = time.Duration(durNs)
+		runs[s.Name] = append(runs[s.Name], s)
+	}
+
+	return runs, rows.Err()
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestAddBuild(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDb(t)
+
+	start := time.Unix(1700000000, 0)
+	for i, outcome := range []string{"succeeded", "failed"} {
+		build := Build{
+			ID:      []string{"first", "second"}[i],
+			Start:   start.Add(time.Duration(i) * time.Minute),
+			End:     start.Add(time.Duration(i)*time.Minute + 10*time.Second),
+			Roots:   []string{"all"},
+			Outcome: outcome,
+		}
+		err := AddBuild(db, build, []BuildStep{
+			{Name: "build", Status: "succeeded", Start: build.Start, Duration: time.Duration(i+1) * time.Second, Reason: "files changed", Attempts: 1},
+			{Name: "lint", Status: "skipped", Reason: "up to date"},
+		}, 10)
+		test.NilErr(t, err)
+	}
+
+	builds, err := GetBuilds(db, 10)
+	test.NilErr(t, err)
+	test.AssertEqual(t, "Expected newest build first", "second", builds[0].ID)
+	test.AssertEqual(t, "roots", []string{"all"}, builds[0].Roots)
+	test.AssertEqual(t, "builds", 2, len(builds))
+
+	runs, err := GetStepRuns(db, 10)
+	test.NilErr(t, err)
+	test.AssertEqual(t, "Expected skipped steps to be left out", 1, len(runs))
+	test.AssertEqual(t, "Expected newest run first", 2*time.Second, runs["build"][0].Duration)
+
+	runs, err = GetStepRuns(db, 1)
+	test.NilErr(t, err)
+	test.AssertEqual(t, "Expected runs of the latest build only", 1, len(runs["build"]))
+}
+
+func TestAddBuild_Prune(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDb(t)
+
+	start := time.Unix(1700000000, 0)
+	for i := range 5 {
+		build := Build{
+			ID:      fmt.Sprintf("build%d", i),
+			Start:   start.Add(time.Duration(i) * time.Minute),
+			End:     start.Add(time.Duration(i)*time.Minute + time.Second),
+			Roots:   []string{"all"},
+			Outcome: "succeeded",
+		}
+		err := AddBuild(db, build, []BuildStep{
+			{Name: "build", Status: "succeeded", Start: build.Start, Duration: time.Second, Attempts: 1},
+		}, 3)
+		test.NilErr(t, err)
+	}
+
+	builds, err := GetBuilds(db, 10)
+	test.NilErr(t, err)
+	test.AssertEqual(t, "Expected the oldest builds to be removed", 3, len(builds))
+	test.AssertEqual(t, "Expected the newest build to be kept", "build4", builds[0].ID)
+	test.AssertEqual(t, "Expected the oldest kept build", "build2", builds[2].ID)
+
+	var steps int
+	err = db.QueryRow("SELECT COUNT(*) FROM build_steps").Scan(&steps)
+	test.NilErr(t, err)
+	test.AssertEqual(t, "Expected the steps of removed builds to be removed", 3, steps)
+}
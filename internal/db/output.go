@@ -0,0 +1,55 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// GetOutputs returns the outputs of the given step, keyed by name.
+func GetOutputs(db *sql.DB, step string) (outputs map[string][]byte, err error) {
+	const stmt = "SELECT name, value FROM outputs WHERE step_name = ?"
+	rows, err := db.Query(stmt, step)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	outputs = map[string][]byte{}
+	for rows.Next() {
+		var (
+			name  string
+			value []byte
+		)
+		err = rows.Scan(&name, &value)
+		if err != nil {
+			return nil, err
+		}
+		outputs[name] = value
+	}
+
+	return outputs, rows.Err()
+}
+
+// SetOutputs replaces the outputs of the given step.
+func SetOutputs(db *sql.DB, step string, outputs map[string][]byte) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const deleteStmt = "DELETE FROM outputs WHERE step_name = ?"
+	_, err = tx.Exec(deleteStmt, step)
+	if err != nil {
+		return err
+	}
+
+	const insertStmt = "INSERT INTO outputs (step_name, name, value) VALUES (?, ?, ?)"
+	for name, value := range outputs {
+		_, err = tx.Exec(insertStmt, step, name, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
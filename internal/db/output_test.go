@@ -0,0 +1,34 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestGetSetOutputs(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDb(t)
+
+	outputs, err := GetOutputs(db, "version")
+	test.NilErr(t, err)
+	test.AssertEqual(t, "Expected no outputs", 0, len(outputs))
+
+	err = SetOutputs(db, "version", map[string][]byte{
+		"commit": []byte(`"abc"`),
+		"dirty":  []byte(`false`),
+	})
+	test.NilErr(t, err)
+
+	err = SetOutputs(db, "version", map[string][]byte{
+		"commit": []byte(`"def"`),
+	})
+	test.NilErr(t, err)
+
+	outputs, err = GetOutputs(db, "version")
+	test.NilErr(t, err)
+	test.AssertEqual(t, "Expected outputs to be replaced", map[string][]byte{
+		"commit": []byte(`"def"`),
+	}, outputs)
+}
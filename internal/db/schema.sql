@@ -2,4 +2,53 @@ CREATE TABLE IF NOT EXISTS hashes
 (
     file_path TEXT PRIMARY KEY,
     hash      BLOB
-);
\ No newline at end of file
+);
+
+CREATE TABLE IF NOT EXISTS fingerprints
+(
+    step_name TEXT PRIMARY KEY,
+    hash      BLOB
+);
+
+CREATE TABLE IF NOT EXISTS outputs
+(
+    step_name TEXT NOT NULL,
+    name      TEXT NOT NULL,
+    value     BLOB,
+    PRIMARY KEY (step_name, name)
+);
+
+CREATE TABLE IF NOT EXISTS durations
+(
+    step_name TEXT PRIMARY KEY,
+    -- duration is a moving average of the step's successful runs, in
+    -- nanoseconds.
+    duration  INTEGER NOT NULL,
+    runs      INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS builds
+(
+    id         TEXT PRIMARY KEY,
+    start_time INTEGER NOT NULL,
+    end_time   INTEGER NOT NULL,
+    -- roots are the names of the steps the build was started with, as a JSON
+    -- array.
+    roots      TEXT    NOT NULL,
+    outcome    TEXT    NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS build_steps
+(
+    build_id   TEXT    NOT NULL REFERENCES builds (id) ON DELETE CASCADE,
+    step_name  TEXT    NOT NULL,
+    status     TEXT    NOT NULL,
+    start_time INTEGER NOT NULL,
+    duration   INTEGER NOT NULL,
+    reason     TEXT    NOT NULL,
+    attempts   INTEGER NOT NULL,
+    exit_code  INTEGER NOT NULL,
+    PRIMARY KEY (build_id, step_name)
+);
+
+CREATE INDEX IF NOT EXISTS build_steps_step_name ON build_steps (step_name);
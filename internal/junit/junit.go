@@ -0,0 +1,100 @@
+package junit
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+// Suites is the root element of a JUnit XML report.
+type Suites struct {
+	XMLName  xml.Name `xml:"testsuites"`
+	Name     string   `xml:"name,attr,omitempty"`
+	Tests    int      `xml:"tests,attr"`
+	Failures int      `xml:"failures,attr"`
+	Errors   int      `xml:"errors,attr"`
+	Skipped  int      `xml:"skipped,attr"`
+	Time     Seconds  `xml:"time,attr"`
+	Suites   []Suite  `xml:"testsuite"`
+}
+
+// Add adds a suite, updating the totals.
+func (s *Suites) Add(suite Suite) {
+	s.Tests += suite.Tests
+	s.Failures += suite.Failures
+	s.Errors += suite.Errors
+	s.Skipped += suite.Skipped
+	s.Time += suite.Time
+	s.Suites = append(s.Suites, suite)
+}
+
+// Suite is a group of test cases, e.g. a package.
+type Suite struct {
+	Name      string  `xml:"name,attr"`
+	Tests     int     `xml:"tests,attr"`
+	Failures  int     `xml:"failures,attr"`
+	Errors    int     `xml:"errors,attr"`
+	Skipped   int     `xml:"skipped,attr"`
+	Time      Seconds `xml:"time,attr"`
+	Timestamp string  `xml:"timestamp,attr,omitempty"`
+	Cases     []Case  `xml:"testcase"`
+	SystemOut string  `xml:"system-out,omitempty"`
+}
+
+// Add adds a test case, updating the totals. The suite's time is left as is.
+func (s *Suite) Add(c Case) {
+	s.Tests++
+	switch {
+	case c.Failure != nil:
+		s.Failures++
+	case c.Error != nil:
+		s.Errors++
+	case c.Skipped != nil:
+		s.Skipped++
+	}
+	s.Cases = append(s.Cases, c)
+}
+
+// Case is a single test case.
+type Case struct {
+	Name      string   `xml:"name,attr"`
+	Classname string   `xml:"classname,attr"`
+	Time      Seconds  `xml:"time,attr"`
+	Failure   *Message `xml:"failure,omitempty"`
+	Error     *Message `xml:"error,omitempty"`
+	Skipped   *Message `xml:"skipped,omitempty"`
+	SystemOut string   `xml:"system-out,omitempty"`
+}
+
+// Message is the failure, error or skip reason of a test case.
+type Message struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+// Seconds is a duration written as fractional seconds.
+type Seconds float64
+
+// NewSeconds converts a duration into seconds.
+func NewSeconds(d time.Duration) Seconds {
+	return Seconds(d.Seconds())
+}
+
+// Write writes the report as indented XML.
+func Write(w io.Writer, s Suites) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(s)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,37 @@
+package junit
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestWrite(t *testing.T) {
+	t.Parallel()
+
+	suite := Suite{
+		Name: "pkg",
+		Time: NewSeconds(1500 * time.Millisecond),
+	}
+	suite.Add(Case{Name: "TestPass", Classname: "pkg"})
+	suite.Add(Case{Name: "TestFail", Classname: "pkg", Failure: &Message{Message: "Failed", Body: "a < b"}})
+	suite.Add(Case{Name: "TestSkip", Classname: "pkg", Skipped: &Message{Message: "Skipped"}})
+
+	var suites Suites
+	suites.Add(suite)
+
+	test.AssertEqual(t, "Unexpected tests", 3, suites.Tests)
+	test.AssertEqual(t, "Unexpected failures", 1, suites.Failures)
+	test.AssertEqual(t, "Unexpected skipped", 1, suites.Skipped)
+
+	var b strings.Builder
+	err := Write(&b, suites)
+	test.NilErr(t, err)
+
+	out := b.String()
+	test.Assert(t, "Expected xml header", strings.HasPrefix(out, `<?xml version="1.0" encoding="UTF-8"?>`))
+	test.Assert(t, "Expected suites element", strings.Contains(out, `<testsuites tests="3" failures="1" errors="0" skipped="1" time="1.5">`))
+	test.Assert(t, "Expected escaped failure body", strings.Contains(out, `<failure message="Failed">a &lt; b</failure>`))
+}
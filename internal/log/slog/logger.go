@@ -2,8 +2,19 @@ package slog
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log/slog"
+
+	"github.com/Genekkion/build.go/internal/util"
+)
+
+// Keys of the trace attributes added to records from the context, see
+// CtxWithTraceID and CtxWithSpan.
+const (
+	TraceIDKey      = "traceId"
+	SpanIDKey       = "spanId"
+	ParentSpanIDKey = "parentSpanId"
 )
 
 // Handler enables the writing of logs to multiple pipes.
@@ -23,8 +34,48 @@ func NewLogger(handlers ...slog.Handler) *slog.Logger {
 	})
 }
 
-// NewHandler creates a new handler.
+// Format represents the format of log lines.
+type Format string
+
+const (
+	// FormatAuto selects FormatPretty when writing to a terminal, and
+	// FormatJSON otherwise.
+	FormatAuto Format = "auto"
+	// FormatJSON writes a JSON object per line, for CI and log processing.
+	FormatJSON Format = "json"
+	// FormatPretty writes human-friendly lines, see PrettyHandler.
+	FormatPretty Format = "pretty"
+)
+
+// ParseFormat parses a log format.
+func ParseFormat(s string) (format Format, err error) {
+	format = Format(s)
+	switch format {
+	case FormatAuto, FormatJSON, FormatPretty:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid log format: %q", s)
+	}
+}
+
+// NewHandler creates a new handler, pretty when writing to a terminal and JSON
+// otherwise.
 func NewHandler(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+	return NewFormatHandler(w, FormatAuto, opts)
+}
+
+// NewFormatHandler creates a new handler for the given format.
+func NewFormatHandler(w io.Writer, format Format, opts *slog.HandlerOptions) slog.Handler {
+	if format == FormatAuto {
+		format = FormatJSON
+		if util.IsTerminal(w) {
+			format = FormatPretty
+		}
+	}
+
+	if format == FormatPretty {
+		return NewPrettyHandler(w, opts, util.UseColor(w))
+	}
 	return slog.NewJSONHandler(w, opts)
 }
 
@@ -35,11 +86,19 @@ func (h *Handler) AddHandler(handler slog.Handler) {
 
 // Handle handles a log record.
 func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	traceId, err := TraceIDFromCtx(ctx)
+	if err == nil {
+		r.Add(TraceIDKey, traceId.String())
+	}
+	spanId, parentId := SpanFromCtx(ctx)
+	if !spanId.IsZero() {
+		r.Add(SpanIDKey, spanId.String())
+	}
+	if !parentId.IsZero() {
+		r.Add(ParentSpanIDKey, parentId.String())
+	}
+
 	for _, sh := range h.subHandlers {
-		traceId, err := traceIdFromCtx(ctx)
-		if err == nil {
-			r.Add("traceId", traceId.String())
-		}
 		err = sh.Handle(ctx, r)
 		if err != nil {
 			return err
@@ -0,0 +1,225 @@
+package slog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// ANSI escape codes for the pretty handler.
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiDim     = "\x1b[2m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiMagenta = "\x1b[35m"
+	ansiCyan    = "\x1b[36m"
+)
+
+// stepKey is the attribute shown in its own aligned column.
+const stepKey = "step"
+
+// prettyState is shared by a pretty handler and the handlers derived from it.
+type prettyState struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+	// stepWidth is the width of the longest step name so far, which the step
+	// column is padded to.
+	stepWidth int
+}
+
+// PrettyHandler writes human-friendly log lines, with the time relative to
+// the start of the build, the step name in an aligned column, and the error
+// highlighted.
+type PrettyHandler struct {
+	state *prettyState
+	opts  slog.HandlerOptions
+	color bool
+
+	step   string
+	attrs  []byte
+	prefix string
+}
+
+// NewPrettyHandler creates a new pretty handler, with colors if color is true.
+func NewPrettyHandler(w io.Writer, opts *slog.HandlerOptions, color bool) *PrettyHandler {
+	h := &PrettyHandler{
+		state: &prettyState{
+			w:     w,
+			start: time.Now(),
+		},
+		color: color,
+	}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+// Enabled checks if the handler is enabled.
+func (h *PrettyHandler) Enabled(_ context.Context, l slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+	return l >= minLevel
+}
+
+// Handle handles a log record.
+func (h *PrettyHandler) Handle(_ context.Context, r slog.Record) error {
+	step := h.step
+	var (
+		attrs bytes.Buffer
+		err   string
+	)
+	attrs.Write(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		switch {
+		case h.prefix == "" && a.Key == stepKey:
+			step = a.Value.String()
+		case h.prefix == "" && a.Key == "error":
+			err = a.Value.String()
+		case h.prefix == "" && (a.Key == TraceIDKey || a.Key == SpanIDKey || a.Key == ParentSpanIDKey):
+			// Only of use when processing logs, and too noisy on a terminal.
+		default:
+			h.appendAttr(&attrs, h.prefix, a)
+		}
+		return true
+	})
+
+	var b bytes.Buffer
+	elapsed := 0.0
+	if !r.Time.IsZero() {
+		elapsed = r.Time.Sub(h.state.start).Seconds()
+	}
+	h.paint(&b, ansiDim, fmt.Sprintf("%7.2fs", elapsed))
+	b.WriteByte(' ')
+	h.paint(&b, levelColor(r.Level), fmt.Sprintf("%-5s", r.Level.String()))
+
+	h.state.mu.Lock()
+	defer h.state.mu.Unlock()
+
+	h.state.stepWidth = max(h.state.stepWidth, len(step))
+	if h.state.stepWidth > 0 {
+		b.WriteByte(' ')
+		h.paint(&b, ansiCyan, fmt.Sprintf("%-*s", h.state.stepWidth, step))
+	}
+
+	b.WriteByte(' ')
+	if r.Level >= slog.LevelError {
+		h.paint(&b, ansiBold, r.Message)
+	} else {
+		b.WriteString(r.Message)
+	}
+	b.Write(attrs.Bytes())
+	if err != "" {
+		b.WriteByte(' ')
+		h.paint(&b, ansiRed+ansiBold, "error: "+err)
+	}
+	b.WriteByte('\n')
+
+	_, writeErr := h.state.w.Write(b.Bytes())
+	return writeErr
+}
+
+// WithAttrs creates a new handler with the given attributes.
+func (h *PrettyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	var b bytes.Buffer
+	b.Write(h.attrs)
+	for _, a := range attrs {
+		if h.prefix == "" && a.Key == stepKey {
+			h2.step = a.Value.String()
+			continue
+		}
+		h.appendAttr(&b, h.prefix, a)
+	}
+	h2.attrs = b.Bytes()
+	return &h2
+}
+
+// WithGroup creates a new handler with the given group name.
+func (h *PrettyHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// appendAttr appends the attribute as " key=value", flattening groups.
+func (h *PrettyHandler) appendAttr(b *bytes.Buffer, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			h.appendAttr(b, prefix, ga)
+		}
+		return
+	}
+
+	b.WriteByte(' ')
+	h.paint(b, ansiDim, prefix+a.Key+"=")
+	b.WriteString(formatValue(a.Value))
+}
+
+// paint writes s in the given color, if colors are enabled.
+func (h *PrettyHandler) paint(b *bytes.Buffer, color string, s string) {
+	if !h.color {
+		b.WriteString(s)
+		return
+	}
+	b.WriteString(color)
+	b.WriteString(s)
+	b.WriteString(ansiReset)
+}
+
+// levelColor returns the color of the level.
+func levelColor(l slog.Level) string {
+	switch {
+	case l >= slog.LevelError:
+		return ansiRed + ansiBold
+	case l >= slog.LevelWarn:
+		return ansiYellow
+	case l >= slog.LevelInfo:
+		return ansiGreen
+	default:
+		return ansiMagenta
+	}
+}
+
+// formatValue formats the value, quoting strings which would otherwise be
+// ambiguous.
+func formatValue(v slog.Value) string {
+	switch v.Kind() {
+	case slog.KindDuration:
+		return v.Duration().String()
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339)
+	}
+
+	s := v.String()
+	if s == "" || strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"' || r == '=' || !unicode.IsPrint(r)
+	}) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
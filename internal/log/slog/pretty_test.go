@@ -0,0 +1,43 @@
+package slog
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestPrettyHandler(t *testing.T) {
+	t.Parallel()
+
+	var b bytes.Buffer
+	logger := slog.New(NewPrettyHandler(&b, nil, false))
+
+	logger.Info("Running step", "step", "build", "files", 2)
+	logger.With("step", "test:linux/amd64").Error("Step failed",
+		"error", errors.New("exit status 1"),
+		"cmd", "go test",
+	)
+	logger.Debug("Hidden")
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	test.AssertEqual(t, "Expected 2 lines", 2, len(lines))
+	test.Assert(t, "Unexpected first line: "+lines[0],
+		strings.HasSuffix(lines[0], " INFO  build Running step files=2"))
+	test.Assert(t, "Unexpected second line: "+lines[1],
+		strings.HasSuffix(lines[1], ` ERROR test:linux/amd64 Step failed cmd="go test" error: exit status 1`))
+}
+
+func TestParseFormat(t *testing.T) {
+	t.Parallel()
+
+	format, err := ParseFormat("json")
+	test.NilErr(t, err)
+	test.AssertEqual(t, "format", FormatJSON, format)
+
+	_, err = ParseFormat("xml")
+	test.Assert(t, "Expected invalid format to fail", err != nil)
+}
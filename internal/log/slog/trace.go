@@ -2,6 +2,8 @@ package slog
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 
 	"github.com/google/uuid"
@@ -13,6 +15,8 @@ type CtxKey int
 const (
 	// ctxTraceID is the key for the trace id in the context.
 	ctxTraceID CtxKey = iota
+	// ctxSpan is the key for the current span in the context.
+	ctxSpan
 )
 
 // CtxWithTraceID adds a trace id to the context.
@@ -24,11 +28,17 @@ func CtxWithTraceID(ctx context.Context) context.Context {
 		)
 		return ctx
 	}
+	return CtxWithTraceIDValue(ctx, traceId)
+}
+
+// CtxWithTraceIDValue adds the given trace id to the context, e.g. to use the
+// id of a build as its trace id.
+func CtxWithTraceIDValue(ctx context.Context, traceId uuid.UUID) context.Context {
 	return context.WithValue(ctx, ctxTraceID, traceId)
 }
 
-// traceIdFromCtx returns the trace id from the context.
-func traceIdFromCtx(ctx context.Context) (*uuid.UUID, error) {
+// TraceIDFromCtx returns the trace id from the context.
+func TraceIDFromCtx(ctx context.Context) (*uuid.UUID, error) {
 	raw := ctx.Value(ctxTraceID)
 	if raw == nil {
 		return nil, fmt.Errorf("trace id not found in context")
@@ -39,3 +49,41 @@ func traceIdFromCtx(ctx context.Context) (*uuid.UUID, error) {
 	}
 	return &v, nil
 }
+
+// SpanID identifies a span, a unit of work such as a step, within a trace.
+type SpanID [8]byte
+
+// String returns the span id in hex, or "" if it is zero.
+func (id SpanID) String() string {
+	if id.IsZero() {
+		return ""
+	}
+	return hex.EncodeToString(id[:])
+}
+
+// IsZero returns whether the span id is unset.
+func (id SpanID) IsZero() bool {
+	return id == SpanID{}
+}
+
+// span represents the current span in the context.
+type span struct {
+	id     SpanID
+	parent SpanID
+}
+
+// CtxWithSpan starts a new span in the context, as a child of the current
+// span if there is one.
+func CtxWithSpan(ctx context.Context) context.Context {
+	s := span{}
+	rand.Read(s.id[:])
+	s.parent, _ = SpanFromCtx(ctx)
+	return context.WithValue(ctx, ctxSpan, s)
+}
+
+// SpanFromCtx returns the current span id and its parent from the context,
+// which are zero if there is none.
+func SpanFromCtx(ctx context.Context) (id SpanID, parent SpanID) {
+	s, _ := ctx.Value(ctxSpan).(span)
+	return s.id, s.parent
+}
@@ -0,0 +1,35 @@
+package slog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+	"github.com/google/uuid"
+)
+
+func TestTraceAttrs(t *testing.T) {
+	t.Parallel()
+
+	var b bytes.Buffer
+	logger := NewLogger(slog.NewJSONHandler(&b, nil))
+
+	traceId := uuid.Must(uuid.NewV7())
+	ctx := CtxWithTraceIDValue(context.Background(), traceId)
+	ctx = CtxWithSpan(ctx)
+	parent, _ := SpanFromCtx(ctx)
+	ctx = CtxWithSpan(ctx)
+	span, _ := SpanFromCtx(ctx)
+
+	logger.InfoContext(ctx, "Running step")
+
+	var rec map[string]string
+	err := json.Unmarshal(b.Bytes(), &rec)
+	test.NilErr(t, err)
+	test.AssertEqual(t, TraceIDKey, traceId.String(), rec[TraceIDKey])
+	test.AssertEqual(t, SpanIDKey, span.String(), rec[SpanIDKey])
+	test.AssertEqual(t, ParentSpanIDKey, parent.String(), rec[ParentSpanIDKey])
+}
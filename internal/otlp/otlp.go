@@ -0,0 +1,237 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Span represents a span to be exported. Ids are in hex, as in the OTLP JSON
+// encoding.
+type Span struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Start        time.Time
+	End          time.Time
+	// Attrs are the attributes of the span, with string, bool, int, int64,
+	// float64 or time.Duration values. Durations are exported in milliseconds.
+	Attrs map[string]any
+	// Err fails the span, with its message as the status message.
+	Err error
+}
+
+// Span kind and status codes, see the OTLP trace protocol.
+const (
+	spanKindInternal = 1
+	statusOk         = 1
+	statusError      = 2
+)
+
+// request is an ExportTraceServiceRequest in the OTLP JSON encoding.
+type request struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+// anyValue holds one of its fields. 64 bit integers are strings in the JSON
+// encoding.
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// Encode returns the spans as an ExportTraceServiceRequest in the OTLP JSON
+// encoding, from the service with the given name and instrumentation scope.
+func Encode(service string, scopeName string, spans []Span) (body []byte, err error) {
+	req := request{
+		ResourceSpans: []resourceSpans{{
+			Resource: resource{
+				Attributes: attributes(map[string]any{"service.name": service}),
+			},
+			ScopeSpans: []scopeSpans{{
+				Scope: scope{Name: scopeName},
+				Spans: make([]span, len(spans)),
+			}},
+		}},
+	}
+
+	out := req.ResourceSpans[0].ScopeSpans[0].Spans
+	for i, s := range spans {
+		out[i] = span{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentSpanID,
+			Name:              s.Name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: unixNano(s.Start),
+			EndTimeUnixNano:   unixNano(s.End),
+			Attributes:        attributes(s.Attrs),
+			Status:            status{Code: statusOk},
+		}
+		if s.Err != nil {
+			out[i].Status = status{
+				Code:    statusError,
+				Message: s.Err.Error(),
+			}
+		}
+	}
+
+	return json.Marshal(req)
+}
+
+// unixNano returns the time in nanoseconds since the epoch, as a string.
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// attributes returns the attributes sorted by key, skipping values of
+// unsupported types.
+func attributes(attrs map[string]any) (kvs []keyValue) {
+	for k, v := range attrs {
+		var av anyValue
+		switch v := v.(type) {
+		case string:
+			av.StringValue = &v
+		case bool:
+			av.BoolValue = &v
+		case int:
+			s := strconv.Itoa(v)
+			av.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			av.IntValue = &s
+		case float64:
+			av.DoubleValue = &v
+		case time.Duration:
+			f := float64(v) / float64(time.Millisecond)
+			av.DoubleValue = &f
+		default:
+			continue
+		}
+		kvs = append(kvs, keyValue{Key: k, Value: av})
+	}
+	slices.SortFunc(kvs, func(a, b keyValue) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return kvs
+}
+
+// Send posts an encoded request to an OTLP/HTTP traces endpoint, e.g.
+// http://localhost:4318/v1/traces, with any extra headers.
+func Send(ctx context.Context, endpoint string, headers map[string]string, body []byte) (err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status from %s: %s: %s", endpoint, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// WriteFile writes an encoded request to the file, as a line of the OTLP JSON
+// file format so that exports of several builds can be appended.
+func WriteFile(fp string, body []byte) (err error) {
+	f, err := os.OpenFile(fp, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(body, '\n'))
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Endpoint returns the traces endpoint for a base URL, e.g.
+// http://localhost:4318, leaving URLs with a path as they are.
+func Endpoint(base string) string {
+	trimmed := strings.TrimSuffix(base, "/")
+	_, rest, ok := strings.Cut(trimmed, "://")
+	if ok && !strings.Contains(rest, "/") {
+		return trimmed + "/v1/traces"
+	}
+	return base
+}
+
+// ParseHeaders parses headers in the form "key1=value1,key2=value2", as in
+// OTEL_EXPORTER_OTLP_HEADERS.
+func ParseHeaders(s string) (headers map[string]string, err error) {
+	headers = map[string]string{}
+	for pair := range strings.SplitSeq(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid header: %q", pair)
+		}
+		headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return headers, nil
+}
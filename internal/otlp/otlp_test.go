@@ -0,0 +1,77 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestSend(t *testing.T) {
+	t.Parallel()
+
+	var (
+		got     request
+		headers http.Header
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/v1/traces" || json.Unmarshal(body, &got) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer collector.Close()
+
+	start := time.Unix(1700000000, 0)
+	body, err := Encode("build.go", "test", []Span{
+		{
+			TraceID: "0123456789abcdef0123456789abcdef",
+			SpanID:  "0123456789abcdef",
+			Name:    "build",
+			Start:   start,
+			End:     start.Add(time.Second),
+			Attrs: map[string]any{
+				"buildgo.step.cache_hit": true,
+				"buildgo.exit_code":      1,
+				"buildgo.duration_ms":    1500 * time.Millisecond,
+			},
+			Err: errors.New("exit status 1"),
+		},
+	})
+	test.NilErr(t, err)
+
+	headerMap, err := ParseHeaders("authorization=Bearer token, x-team = builds")
+	test.NilErr(t, err)
+	err = Send(context.Background(), Endpoint(collector.URL), headerMap, body)
+	test.NilErr(t, err)
+	test.AssertEqual(t, "authorization", "Bearer token", headers.Get("Authorization"))
+	test.AssertEqual(t, "x-team", "builds", headers.Get("X-Team"))
+
+	spans := got.ResourceSpans[0].ScopeSpans[0].Spans
+	test.AssertEqual(t, "spans", 1, len(spans))
+	s := spans[0]
+	test.AssertEqual(t, "start", "1700000000000000000", s.StartTimeUnixNano)
+	test.AssertEqual(t, "status", statusError, s.Status.Code)
+	test.AssertEqual(t, "attributes", 3, len(s.Attributes))
+	test.AssertEqual(t, "duration key", "buildgo.duration_ms", s.Attributes[0].Key)
+	test.AssertEqual(t, "duration", 1500.0, *s.Attributes[0].Value.DoubleValue)
+	test.AssertEqual(t, "exit code", "1", *s.Attributes[1].Value.IntValue)
+	test.AssertEqual(t, "cache hit", true, *s.Attributes[2].Value.BoolValue)
+
+	err = Send(context.Background(), collector.URL+"/wrong", nil, body)
+	test.Assert(t, "Expected error status to fail", err != nil)
+}
+
+func TestEndpoint(t *testing.T) {
+	t.Parallel()
+
+	test.AssertEqual(t, "base", "http://localhost:4318/v1/traces", Endpoint("http://localhost:4318/"))
+	test.AssertEqual(t, "path", "https://otel.example.com/custom", Endpoint("https://otel.example.com/custom"))
+}
@@ -0,0 +1,213 @@
+// Package success decides whether a command succeeded from its exit code and
+// output, for commands where a non-zero exit code is not always a failure.
+package success
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os/exec"
+	"regexp"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// Policy represents the rules for deciding whether a command succeeded. The
+// zero value only accepts exit code 0. Commands killed by a signal, e.g. as
+// they were cancelled, never succeed.
+type Policy struct {
+	// Codes are the accepted exit codes. Only 0 is accepted if empty.
+	Codes []int
+	// FailOnStderr fails the command if it writes anything to stderr, even if
+	// it exits with an accepted code.
+	FailOnStderr bool
+	// Matcher accepts a command which exited with one of MatchCodes if any
+	// line of its output matches, or with any code if MatchCodes is empty and
+	// every line of its output matches, as then nothing else points to a
+	// failure.
+	Matcher *regexp.Regexp
+	// MatchCodes are the exit codes Matcher accepts, see Matcher.
+	MatchCodes []int
+}
+
+// IsZero returns whether the policy is the default one, in which case the
+// output does not need to be inspected.
+func (p Policy) IsZero() bool {
+	return len(p.Codes) == 0 && !p.FailOnStderr && p.Matcher == nil && len(p.MatchCodes) == 0
+}
+
+// Run tracks the output of a single run of a command.
+type Run struct {
+	policy    Policy
+	stderr    atomic.Bool
+	matched   atomic.Bool
+	unmatched atomic.Bool
+
+	mu       sync.Mutex
+	watchers []*watcher
+}
+
+// Start starts tracking a run of a command.
+func (p Policy) Start() *Run {
+	return &Run{
+		policy: p,
+	}
+}
+
+// Stdout returns a writer which writes to w while inspecting stdout.
+func (r *Run) Stdout(w io.Writer) io.Writer {
+	return r.watch(w, nil)
+}
+
+// Stderr returns a writer which writes to w while inspecting stderr.
+func (r *Run) Stderr(w io.Writer) io.Writer {
+	return r.watch(w, &r.stderr)
+}
+
+// Combined returns writers for stdout and stderr which both write to w, like
+// "2>&1". Writes to w are serialised, as the command writes to both at the
+// same time, while output on stderr is still told apart.
+func (r *Run) Combined(w io.Writer) (stdout io.Writer, stderr io.Writer) {
+	if w == nil {
+		w = io.Discard
+	}
+	if r.policy.IsZero() {
+		// The command is given a single pipe for both.
+		return w, w
+	}
+
+	w = &lockedWriter{w: w}
+	return r.watch(w, nil), r.watch(w, &r.stderr)
+}
+
+// watch returns a writer which writes to w, flagging written on any output.
+func (r *Run) watch(w io.Writer, written *atomic.Bool) io.Writer {
+	if w == nil {
+		w = io.Discard
+	}
+	if r.policy.IsZero() {
+		return w
+	}
+
+	wr := &watcher{
+		run:     r,
+		w:       w,
+		written: written,
+	}
+	r.mu.Lock()
+	r.watchers = append(r.watchers, wr)
+	r.mu.Unlock()
+	return wr
+}
+
+// Result returns the error of the run given the error the command exited
+// with, which is nil if the policy accepts the run. It must be called once
+// the command has exited.
+func (r *Run) Result(err error) error {
+	r.mu.Lock()
+	for _, w := range r.watchers {
+		w.flush()
+	}
+	r.mu.Unlock()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if !exitErr.Exited() {
+			return err
+		}
+
+		code := exitErr.ExitCode()
+		if slices.Contains(r.policy.Codes, code) || r.matchAccepts(code) {
+			err = nil
+		}
+	} else if err == nil && len(r.policy.Codes) > 0 && !slices.Contains(r.policy.Codes, 0) {
+		err = errors.New("exit status 0 is not accepted")
+	}
+
+	if err == nil && r.policy.FailOnStderr && r.stderr.Load() {
+		return errors.New("command wrote to stderr")
+	}
+	return err
+}
+
+// matchAccepts returns whether the matcher accepts the run which exited with
+// the code, see Policy.Matcher.
+func (r *Run) matchAccepts(code int) bool {
+	if !r.matched.Load() {
+		return false
+	} else if len(r.policy.MatchCodes) > 0 {
+		return slices.Contains(r.policy.MatchCodes, code)
+	}
+	return !r.unmatched.Load()
+}
+
+// watcher represents a writer inspecting the output of a command.
+type watcher struct {
+	run     *Run
+	w       io.Writer
+	written *atomic.Bool
+
+	mu   sync.Mutex
+	line []byte
+}
+
+// Write writes p to the underlying writer, matching complete lines against
+// the policy's matcher.
+func (w *watcher) Write(p []byte) (n int, err error) {
+	if w.written != nil && len(p) > 0 {
+		w.written.Store(true)
+	}
+
+	if w.run.policy.Matcher != nil {
+		w.mu.Lock()
+		w.line = append(w.line, p...)
+		for {
+			i := bytes.IndexByte(w.line, '\n')
+			if i < 0 {
+				break
+			}
+			w.match(w.line[:i])
+			w.line = w.line[i+1:]
+		}
+		w.mu.Unlock()
+	}
+
+	return w.w.Write(p)
+}
+
+// flush matches the last line, which has no trailing newline.
+func (w *watcher) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.run.policy.Matcher != nil && len(w.line) > 0 {
+		w.match(w.line)
+	}
+	w.line = nil
+}
+
+// match matches a line of output. Blank lines are ignored.
+func (w *watcher) match(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	} else if w.run.policy.Matcher.Match(line) {
+		w.run.matched.Store(true)
+	} else {
+		w.run.unmatched.Store(true)
+	}
+}
+
+// lockedWriter represents a writer shared by several goroutines.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Write writes p to the underlying writer.
+func (w *lockedWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
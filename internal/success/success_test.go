@@ -0,0 +1,59 @@
+package success
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"regexp"
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+// run runs the shell script under the policy.
+func run(t *testing.T, p Policy, script string) error {
+	t.Helper()
+
+	r := p.Start()
+	cmd := exec.CommandContext(context.Background(), "sh", "-c", script)
+	cmd.Stdout = r.Stdout(io.Discard)
+	cmd.Stderr = r.Stderr(io.Discard)
+	return r.Result(cmd.Run())
+}
+
+func TestPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		policy Policy
+		script string
+		ok     bool
+	}{
+		{"default success", Policy{}, "exit 0", true},
+		{"default failure", Policy{}, "exit 2", false},
+		{"accepted code", Policy{Codes: []int{0, 2}}, "exit 2", true},
+		{"unaccepted code", Policy{Codes: []int{0, 2}}, "exit 1", false},
+		{"zero not accepted", Policy{Codes: []int{1}}, "exit 0", false},
+		{"stderr", Policy{FailOnStderr: true}, "echo warning >&2", false},
+		{"no stderr", Policy{FailOnStderr: true}, "echo ok", true},
+		{"matched", Policy{Matcher: regexp.MustCompile(`no test files`)}, "printf '[no test files]'; exit 1", true},
+		{"not matched", Policy{Matcher: regexp.MustCompile(`no test files`)}, "echo FAIL; exit 1", false},
+		{"matched with another failure", Policy{Matcher: regexp.MustCompile(`no test files`)},
+			"echo '?   a [no test files]'; echo 'FAIL b 0.1s'; exit 1", false},
+		{"matched with accepted code", Policy{Matcher: regexp.MustCompile(`nothing to do`), MatchCodes: []int{2}},
+			"echo checking; echo 'nothing to do'; exit 2", true},
+		{"matched with unaccepted code", Policy{Matcher: regexp.MustCompile(`nothing to do`), MatchCodes: []int{2}},
+			"echo 'nothing to do'; exit 1", false},
+		{"matched and killed", Policy{Codes: []int{-1}, Matcher: regexp.MustCompile(`nothing to do`)},
+			"echo 'nothing to do'; kill -KILL $$", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := run(t, tt.policy, tt.script)
+			test.AssertEqual(t, "Expected success to match", tt.ok, err == nil)
+		})
+	}
+}
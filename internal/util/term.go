@@ -0,0 +1,32 @@
+package util
+
+import (
+	"io"
+	"os"
+)
+
+// IsTerminal returns whether w is a terminal. Besides *os.File, writers
+// wrapping a file can implement Stat to be detected.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(interface {
+		Stat() (os.FileInfo, error)
+	})
+	if !ok {
+		return false
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// UseColor returns whether colors should be written to w, which is when it is
+// a terminal and neither NO_COLOR is set nor TERM is "dumb".
+func UseColor(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return IsTerminal(w)
+}
@@ -0,0 +1,416 @@
+package buildgo
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/log/slog"
+	"github.com/Genekkion/build.go/internal/otlp"
+	"github.com/google/uuid"
+)
+
+// Main runs the build from the command line, with the steps named in the
+// arguments or all of the given steps if none are named. Steps can also be
+// selected with patterns such as 'test:*', and by tag with -tag. Setup must
+// have been called beforehand. Exits with status 1 if the build fails.
+//
+// Usage: go run ./build [run] [flags] [step|pattern...]
+func Main(steps ...*Step) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := RunArgs(ctx, os.Args[1:], steps...)
+	stop()
+	if errors.Is(err, flag.ErrHelp) {
+		Cleanup()
+		os.Exit(0)
+	} else if err != nil {
+		Cleanup()
+		os.Exit(1)
+	}
+}
+
+// RunArgs runs the build with the given command line arguments, see Main.
+// The first argument may be a subcommand: "run", the default, "list" to list
+// the steps, or "history" to show past builds.
+func RunArgs(ctx context.Context, args []string, steps ...*Step) (err error) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "run":
+			args = args[1:]
+		case "list":
+			return runList(args[1:], steps)
+		case "history":
+			return runHistory(args[1:])
+		}
+	}
+	return runBuild(ctx, args, steps)
+}
+
+// runBuild runs the build, see Main.
+func runBuild(ctx context.Context, args []string, steps []*Step) (err error) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	output := fs.String("output", string(ConsoleOutput), "how step output is shown: stream, grouped or errors")
+	jobs := fs.Int("jobs", Jobs, "maximum number of steps to run in parallel")
+	// The Logger is only replaced if the format is set, so that one set up by
+	// the build script is kept otherwise.
+	var logFormat *slog.Format
+	fs.Func("log-format", "log format: auto, json or pretty (default auto)", func(s string) error {
+		format, err := slog.ParseFormat(s)
+		if err != nil {
+			return err
+		}
+		logFormat = &format
+		return nil
+	})
+	progress := fs.Bool("progress", true, "show build progress, live on a terminal and logged periodically otherwise")
+	trace := fs.String("trace", "", "write a Chrome trace of the build to the file, for chrome://tracing or Perfetto")
+	otlpURL := fs.String("otlp-endpoint", "", "export spans of the build to the OTLP/HTTP endpoint, e.g. http://localhost:4318, "+
+		"defaulting to $OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or $OTEL_EXPORTER_OTLP_ENDPOINT")
+	otlpFile := fs.String("otlp-file", "", "append spans of the build to the file in the OTLP JSON format")
+	var reports []reportSpec
+	fs.Func("report", "write a report of the build, as junit:path or json:path; can be repeated", func(s string) error {
+		spec, err := parseReportSpec(s)
+		if err != nil {
+			return err
+		}
+		reports = append(reports, spec)
+		return nil
+	})
+	tags := tagFlag(fs)
+	var force forceFlag
+	fs.Var(&force, "force", "force a rebuild of all steps, or of the given step as with -force-step")
+	fs.Func("force-step", "force a rebuild of the step, which may be a pattern; can be repeated", func(s string) error {
+		return force.Set(s)
+	})
+	forceDependents := fs.Bool("force-dependents", false, "also force a rebuild of the dependents of steps given to -force-step")
+	fs.Usage = func() {
+		w := fs.Output()
+		fmt.Fprintf(w, "Usage: %s [run] [flags] [step|pattern...]\n", fs.Name())
+		fmt.Fprintf(w, "       %s list [flags] [step|pattern...]\n", fs.Name())
+		fmt.Fprintf(w, "       %s history [flags]\n\nFlags:\n", fs.Name())
+		fs.PrintDefaults()
+		fmt.Fprintf(w, "\nSteps:\n")
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, s := range graph(steps) {
+			fmt.Fprintf(tw, "  %s\t%s\n", s.name, s.description)
+		}
+		tw.Flush()
+	}
+
+	err = fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if logFormat != nil {
+		Logger = newLogger(*logFormat)
+	}
+
+	ConsoleOutput, err = ParseOutputMode(*output)
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		return err
+	}
+	Jobs = *jobs
+
+	targets, err := selectSteps(steps, fs.Args(), *tags)
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		return err
+	}
+
+	ctx = withBuild(ctx)
+	all := graph(targets)
+	err = forceSteps(all, force, *forceDependents)
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		return err
+	}
+	prioritise(all)
+
+	start := time.Now()
+	if *progress {
+		stop := startProgress(ctx, all)
+		err = runSteps(ctx, targets)
+		stop()
+	} else {
+		err = runSteps(ctx, targets)
+	}
+	end := time.Now()
+	recordBuild(start, targets, err)
+
+	logCriticalPath(ctx, all)
+	if *trace != "" {
+		traceErr := writeTrace(*trace, start, end, all)
+		if traceErr != nil {
+			Logger.WarnContext(ctx, "Unable to write trace",
+				"file", *trace,
+				"error", traceErr,
+			)
+		}
+	}
+	endpoint := otlpEndpoint()
+	if *otlpURL != "" {
+		endpoint = otlp.Endpoint(*otlpURL)
+	}
+	if endpoint != "" || *otlpFile != "" {
+		otlpErr := exportSpans(ctx, endpoint, *otlpFile, start, end, all, err)
+		if otlpErr != nil {
+			Logger.WarnContext(ctx, "Unable to export spans",
+				"error", otlpErr,
+			)
+		}
+	}
+	reportErr := writeReports(reports, start, end, targets, err)
+	if reportErr != nil {
+		Logger.WarnContext(ctx, "Unable to write reports",
+			"error", reportErr,
+		)
+	}
+	if err != nil {
+		Logger.ErrorContext(ctx, "Build failed",
+			"buildId", BuildID,
+			"duration", time.Since(start),
+			"error", err,
+		)
+		return err
+	}
+
+	Logger.InfoContext(ctx, "Build completed",
+		"buildId", BuildID,
+		"duration", time.Since(start),
+	)
+	return nil
+}
+
+// withBuild returns the context with the trace of the build, identified by
+// BuildID, and its root span, which the spans of steps and commands are
+// children of.
+func withBuild(ctx context.Context) context.Context {
+	traceId, err := uuid.Parse(BuildID)
+	if err != nil {
+		ctx = slog.CtxWithTraceID(ctx)
+	} else {
+		ctx = slog.CtxWithTraceIDValue(ctx, traceId)
+	}
+	return slog.CtxWithSpan(ctx)
+}
+
+// graph returns the steps and all of their dependencies, in dependency order.
+func graph(steps []*Step) (all []*Step) {
+	seen := map[*Step]bool{}
+	var visit func(s *Step)
+	visit = func(s *Step) {
+		if seen[s] {
+			return
+		}
+		seen[s] = true
+		for _, dep := range s.dependsOn {
+			visit(dep)
+		}
+		all = append(all, s)
+	}
+	for _, s := range steps {
+		visit(s)
+	}
+	return all
+}
+
+// runList lists the selected steps, see selectSteps, or all of the steps and
+// their dependencies, with their tags and descriptions.
+func runList(args []string, steps []*Step) (err error) {
+	fs := flag.NewFlagSet(os.Args[0]+" list", flag.ContinueOnError)
+	tags := tagFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] [step|pattern...]\n\nFlags:\n", fs.Name())
+		fs.PrintDefaults()
+	}
+
+	err = fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	selected := graph(steps)
+	if fs.NArg() > 0 || len(*tags) > 0 {
+		selected, err = selectSteps(steps, fs.Args(), *tags)
+		if err != nil {
+			fmt.Fprintln(fs.Output(), err)
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(consoleStdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tTAGS\tDEPENDS ON\tDESCRIPTION")
+	for _, s := range selected {
+		deps := make([]string, len(s.dependsOn))
+		for i, dep := range s.dependsOn {
+			deps[i] = dep.name
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			s.name,
+			strings.Join(s.tags, ", "),
+			strings.Join(deps, ", "),
+			s.description,
+		)
+	}
+	return w.Flush()
+}
+
+// tagFlag adds the -tag flag for selecting steps by tag, which can be
+// repeated.
+func tagFlag(fs *flag.FlagSet) *[]string {
+	var tags []string
+	fs.Func("tag", "select steps with the tag; can be repeated to select steps with any of the tags", func(s string) error {
+		tags = append(tags, s)
+		return nil
+	})
+	return &tags
+}
+
+// forceFlag represents the -force flag, which forces a rebuild of all steps
+// when given on its own, or of the steps matching the given patterns.
+type forceFlag struct {
+	all      bool
+	patterns []string
+}
+
+// String returns the value of the flag.
+func (f *forceFlag) String() string {
+	if f == nil || (!f.all && len(f.patterns) == 0) {
+		return ""
+	} else if f.all {
+		return "true"
+	}
+	return strings.Join(f.patterns, ",")
+}
+
+// Set sets the value of the flag.
+func (f *forceFlag) Set(s string) error {
+	switch s {
+	case "true":
+		f.all = true
+	case "false", "":
+		f.all = false
+	default:
+		f.patterns = append(f.patterns, s)
+	}
+	return nil
+}
+
+// IsBoolFlag allows the flag to be given without a value.
+func (f *forceFlag) IsBoolFlag() bool {
+	return true
+}
+
+// forceSteps marks the steps to be rebuilt regardless of the cache, out of
+// all of the steps of the build, optionally along with their dependents.
+func forceSteps(all []*Step, force forceFlag, dependents bool) (err error) {
+	for _, s := range all {
+		s.forced = force.all
+	}
+	if force.all || len(force.patterns) == 0 {
+		return nil
+	}
+
+	forced, err := selectSteps(all, force.patterns, nil)
+	if err != nil {
+		return err
+	}
+
+	reverse := map[*Step][]*Step{}
+	for _, s := range all {
+		for _, dep := range s.dependsOn {
+			reverse[dep] = append(reverse[dep], s)
+		}
+	}
+	for len(forced) > 0 {
+		s := forced[0]
+		forced = forced[1:]
+		if s.forced {
+			continue
+		}
+		s.forced = true
+		if dependents {
+			forced = append(forced, reverse[s]...)
+		}
+	}
+	return nil
+}
+
+// selectSteps returns the steps matching any of the patterns, and with any
+// of the tags if given, from the steps and their dependencies. A pattern is a
+// step name, in which * matches any characters and ? any single character.
+// All of the steps are returned if there are no patterns or tags.
+func selectSteps(steps []*Step, patterns []string, tags []string) (selected []*Step, err error) {
+	if len(patterns) == 0 && len(tags) == 0 {
+		return steps, nil
+	}
+
+	all := graph(steps)
+	candidates := all
+	if len(patterns) > 0 {
+		candidates = nil
+		for _, pattern := range patterns {
+			found := false
+			for _, s := range all {
+				if !matchPattern(pattern, s.name) {
+					continue
+				}
+				found = true
+				if !slices.Contains(candidates, s) {
+					candidates = append(candidates, s)
+				}
+			}
+			if !found {
+				available := make([]string, len(all))
+				for j, s := range all {
+					available[j] = s.name
+				}
+				return nil, fmt.Errorf("unknown step %q, available steps: %s", pattern, strings.Join(available, ", "))
+			}
+		}
+	}
+
+	for _, s := range candidates {
+		if len(tags) == 0 || slices.ContainsFunc(tags, s.HasTag) {
+			selected = append(selected, s)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no steps selected with tags: %s", strings.Join(tags, ", "))
+	}
+	return selected, nil
+}
+
+// matchPattern returns whether the step name matches the pattern, see
+// selectSteps. Unlike path.Match, * also matches "/", as in "test:*" for
+// "test:linux/amd64".
+func matchPattern(pattern string, name string) bool {
+	if !strings.ContainsAny(pattern, "*?") {
+		return pattern == name
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String()).MatchString(name)
+}
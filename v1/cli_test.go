@@ -0,0 +1,99 @@
+package buildgo
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestSelectSteps(t *testing.T) {
+	t.Parallel()
+
+	lint := NewStep("lint").Tags("lint", "ci")
+	linux := NewStep("test:linux/amd64").Tags("ci")
+	darwin := NewStep("test:darwin/arm64").Tags("ci")
+	release := NewStep("release").Tags("release").DependsOn(linux, darwin)
+	ci := Group("ci", lint, linux, darwin)
+	steps := []*Step{ci, release}
+
+	names := func(steps []*Step) (names []string) {
+		for _, s := range steps {
+			names = append(names, s.name)
+		}
+		return names
+	}
+
+	selected, err := selectSteps(steps, nil, nil)
+	test.NilErr(t, err)
+	test.AssertEqual(t, "all", []string{"ci", "release"}, names(selected))
+
+	selected, err = selectSteps(steps, []string{"test:*"}, nil)
+	test.NilErr(t, err)
+	test.AssertEqual(t, "pattern", []string{"test:linux/amd64", "test:darwin/arm64"}, names(selected))
+
+	selected, err = selectSteps(steps, nil, []string{"lint", "release"})
+	test.NilErr(t, err)
+	test.AssertEqual(t, "tags", []string{"lint", "release"}, names(selected))
+
+	selected, err = selectSteps(steps, []string{"*"}, []string{"ci"})
+	test.NilErr(t, err)
+	test.AssertEqual(t, "pattern and tag", 3, len(selected))
+
+	_, err = selectSteps(steps, []string{"deploy"}, nil)
+	test.Assert(t, "Expected unknown step to fail", err != nil)
+	_, err = selectSteps(steps, nil, []string{"nightly"})
+	test.Assert(t, "Expected unknown tag to fail", err != nil)
+}
+
+func TestForceSteps(t *testing.T) {
+	t.Parallel()
+
+	gen := NewStep("generate")
+	build := NewStep("build").DependsOn(gen)
+	deploy := NewStep("deploy").DependsOn(build)
+	lint := NewStep("lint")
+	all := graph([]*Step{deploy, lint})
+
+	forced := func() (names []string) {
+		for _, s := range all {
+			if s.forced {
+				names = append(names, s.name)
+			}
+		}
+		return names
+	}
+
+	var force forceFlag
+	test.NilErr(t, force.Set("build"))
+	test.NilErr(t, forceSteps(all, force, false))
+	test.AssertEqual(t, "step", []string{"build"}, forced())
+
+	test.NilErr(t, forceSteps(all, force, true))
+	test.AssertEqual(t, "dependents", []string{"build", "deploy"}, forced())
+
+	test.NilErr(t, force.Set("true"))
+	test.NilErr(t, forceSteps(all, force, false))
+	test.AssertEqual(t, "all", 4, len(forced()))
+
+	test.Assert(t, "Expected unknown step to fail", forceSteps(all, forceFlag{patterns: []string{"test"}}, false) != nil)
+}
+
+func TestRunArgs_Logger(t *testing.T) {
+	logger := Logger
+	t.Cleanup(func() {
+		Logger = logger
+	})
+
+	custom := slog.New(slog.NewTextHandler(io.Discard, nil))
+	Logger = custom
+	err := RunArgs(context.Background(), []string{"-progress=false", "noop"}, NewStep("noop"))
+	test.NilErr(t, err)
+	test.Assert(t, "Expected the logger to be kept", Logger == custom)
+
+	err = RunArgs(context.Background(), []string{"-progress=false", "-log-format=json", "noop"}, NewStep("noop"))
+	test.NilErr(t, err)
+	test.Assert(t, "Expected the logger to be replaced", Logger != custom)
+}
@@ -1,9 +1,66 @@
 package buildgo
 
-import "context"
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/Genekkion/build.go/internal/log/slog"
+)
 
 // Command represents a runnable command as part of a build step.
 type Command interface {
 	// Run executes the command.
 	Run(ctx context.Context) error
 }
+
+// Stopper is implemented by commands which leave something running after Run
+// returns, such as background services.
+type Stopper interface {
+	// Stop tears down whatever Run left running. It is safe to call more than
+	// once.
+	Stop() error
+}
+
+// Fingerprinter is implemented by commands whose configuration affects what
+// they produce, e.g. build flags. A change in fingerprint causes the step to
+// be rebuilt, even if none of its file dependencies have changed.
+type Fingerprinter interface {
+	// Fingerprint returns a hash of the command's configuration.
+	Fingerprint() []byte
+}
+
+// Reporter is implemented by commands which produce a structured report, e.g.
+// test results. Reports are collected into the step's Result after it runs.
+type Reporter interface {
+	// Report returns the report of the last run, or nil if there is none.
+	Report() any
+}
+
+// CommandName describes the command for logs and traces, using its String
+// method if it has one and its type otherwise.
+func CommandName(cmd Command) string {
+	if s, ok := cmd.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", cmd), "*")
+}
+
+// Environ returns the environment variables which identify the build to the
+// processes of commands, so that tools can correlate their logs with it:
+// BUILDGO_BUILD_ID, BUILDGO_STEP when run by a step, and TRACEPARENT in the
+// W3C Trace Context format.
+func Environ(ctx context.Context) (env []string) {
+	env = append(env, "BUILDGO_BUILD_ID="+BuildID)
+	if s := StepFromCtx(ctx); s != nil {
+		env = append(env, "BUILDGO_STEP="+s.name)
+	}
+
+	traceId, err := slog.TraceIDFromCtx(ctx)
+	spanId, _ := slog.SpanFromCtx(ctx)
+	if err == nil && !spanId.IsZero() {
+		env = append(env, fmt.Sprintf("TRACEPARENT=00-%s-%s-01", hex.EncodeToString(traceId[:]), spanId))
+	}
+	return env
+}
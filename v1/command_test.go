@@ -0,0 +1,29 @@
+package buildgo
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestEnviron(t *testing.T) {
+	t.Parallel()
+
+	env := Environ(context.Background())
+	test.AssertEqual(t, "env", []string{"BUILDGO_BUILD_ID=" + BuildID}, env)
+
+	ctx := withStep(withBuild(context.Background()), &Step{name: "build"})
+	env = Environ(ctx)
+	test.Assert(t, "Expected step in env", slices.Contains(env, "BUILDGO_STEP=build"))
+
+	i := slices.IndexFunc(env, func(kv string) bool {
+		return strings.HasPrefix(kv, "TRACEPARENT=")
+	})
+	test.Assert(t, "Expected traceparent in env", i >= 0)
+	parts := strings.Split(strings.TrimPrefix(env[i], "TRACEPARENT="), "-")
+	test.AssertEqual(t, "traceparent parts", 4, len(parts))
+	test.AssertEqual(t, "trace id", strings.ReplaceAll(BuildID, "-", ""), parts[1])
+}
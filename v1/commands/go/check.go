@@ -0,0 +1,296 @@
+package cmdgo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	buildgo "github.com/Genekkion/build.go/v1"
+)
+
+// Diagnostic represents a single problem reported by a tool.
+type Diagnostic struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+// String returns the diagnostic in the form "file:line:column: message".
+func (d Diagnostic) String() string {
+	var b strings.Builder
+	b.WriteString(d.File)
+	if d.Line > 0 {
+		b.WriteString(":" + strconv.Itoa(d.Line))
+	}
+	if d.Column > 0 {
+		b.WriteString(":" + strconv.Itoa(d.Column))
+	}
+	b.WriteString(": " + d.Message)
+	return b.String()
+}
+
+// DiagnosticReport represents the problems reported by vet, generate or one of
+// the checks.
+type DiagnosticReport struct {
+	Diagnostics []Diagnostic
+	// Diff is the change needed to fix the problems, for the checks.
+	Diff string
+}
+
+// NewVetCmd creates a new go vet command.
+func NewVetCmd(cwd string, targets []string, args []string, opts ...Option) (cmd *GoCmd, err error) {
+	cmd, err = newCmd(kindVet, cwd, targets, args, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	buildgo.Logger.Debug("Go vet command created",
+		"compilerPath", cmd.cfg.compilerPath,
+		"cwd", cmd.cwd,
+		"targets", cmd.targets,
+		"args", cmd.args,
+	)
+
+	args = append([]string{
+		cmd.cfg.compilerPath, "vet",
+	}, cmd.cfg.flags()...)
+	args = append(args, cmd.args...)
+	args = append(args, cmd.targets...)
+	cmd.args = args
+
+	return cmd, nil
+}
+
+// NewGenerateCmd creates a new go generate command.
+func NewGenerateCmd(cwd string, targets []string, args []string, opts ...Option) (cmd *GoCmd, err error) {
+	cmd, err = newCmd(kindGenerate, cwd, targets, args, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	buildgo.Logger.Debug("Go generate command created",
+		"compilerPath", cmd.cfg.compilerPath,
+		"cwd", cmd.cwd,
+		"targets", cmd.targets,
+		"args", cmd.args,
+	)
+
+	args = append([]string{
+		cmd.cfg.compilerPath, "generate",
+	}, cmd.cfg.flags()...)
+	args = append(args, cmd.args...)
+	args = append(args, cmd.targets...)
+	cmd.args = args
+
+	return cmd, nil
+}
+
+// NewFmtCheckCmd creates a new command which fails if any go file under the
+// targets, which are files or directories, is not formatted. The files are
+// listed as diagnostics, along with a diff of the changes gofmt would make.
+// Files are never modified.
+func NewFmtCheckCmd(cwd string, targets []string, args []string, opts ...Option) (cmd *GoCmd, err error) {
+	cmd, err = newCmd(kindFmt, cwd, targets, args, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, target := range cmd.targets {
+		// gofmt walks directories recursively already.
+		cmd.targets[i] = strings.TrimSuffix(target, "/...")
+		if cmd.targets[i] == "" {
+			cmd.targets[i] = "."
+		}
+	}
+
+	buildgo.Logger.Debug("Gofmt check command created",
+		"compilerPath", cmd.cfg.compilerPath,
+		"cwd", cmd.cwd,
+		"targets", cmd.targets,
+		"args", cmd.args,
+	)
+
+	args = append([]string{gofmtPath(cmd.cfg.compilerPath), "-l"}, cmd.args...)
+	args = append(args, cmd.targets...)
+	cmd.args = args
+
+	return cmd, nil
+}
+
+// NewModTidyCheckCmd creates a new command which fails if go mod tidy would
+// change go.mod or go.sum, using go mod tidy -diff so that neither file is
+// modified. The files are listed as diagnostics, along with the diff.
+func NewModTidyCheckCmd(cwd string, opts ...Option) (cmd *GoCmd, err error) {
+	cmd, err = newCmd(kindModTidy, cwd, nil, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	buildgo.Logger.Debug("Go mod tidy check command created",
+		"compilerPath", cmd.cfg.compilerPath,
+		"cwd", cmd.cwd,
+	)
+
+	cmd.args = []string{cmd.cfg.compilerPath, "mod", "tidy", "-diff"}
+
+	return cmd, nil
+}
+
+// gofmtPath returns the path of the gofmt next to the go compiler, falling
+// back to the one on the PATH.
+func gofmtPath(compilerPath string) string {
+	name := "gofmt"
+	if filepath.Ext(compilerPath) == ".exe" {
+		name += ".exe"
+	}
+
+	fp := filepath.Join(filepath.Dir(compilerPath), name)
+	_, err := os.Stat(fp)
+	if err == nil {
+		return fp
+	}
+
+	fp, err = exec.LookPath("gofmt")
+	if err != nil {
+		return "gofmt"
+	}
+	return fp
+}
+
+// output runs the command line, returning its stdout. Stderr is included in
+// the error if the command fails.
+func (c GoCmd) output(ctx context.Context, args []string) (out []byte, err error) {
+	buildgo.Logger.DebugContext(ctx, "Running go command",
+		"cwd", c.cwd,
+		"args", args,
+	)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = c.cwd
+	cmd.Stderr = &stderr
+	cmd.Env = slices.Concat(os.Environ(), c.cfg.environ(), buildgo.Environ(ctx))
+
+	out, err = cmd.Output()
+	if err != nil && stderr.Len() > 0 {
+		return out, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, err
+}
+
+// runFmt runs the gofmt check.
+func (c GoCmd) runFmt(ctx context.Context) (err error) {
+	*c.diags = DiagnosticReport{}
+
+	out, err := c.output(ctx, c.args)
+	if err != nil {
+		return err
+	}
+
+	// gofmt -l lists a file per line, and paths may contain spaces.
+	var files []string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line != "" {
+			files = append(files, line)
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	for _, fp := range files {
+		if !filepath.IsAbs(fp) {
+			fp = filepath.Join(c.cwd, fp)
+		}
+		c.diags.Diagnostics = append(c.diags.Diagnostics, Diagnostic{
+			File:    fp,
+			Message: "file is not formatted",
+		})
+	}
+
+	// gofmt -d exits with status 1 when there are differences.
+	diffArgs := append([]string{c.args[0], "-d"}, files...)
+	diff, err := c.output(ctx, diffArgs)
+	if err != nil && len(diff) == 0 {
+		return err
+	}
+	c.diags.Diff = string(diff)
+	buildgo.Stdout(ctx).Write(diff)
+
+	return fmt.Errorf("%d files are not formatted", len(files))
+}
+
+// runModTidy runs the go mod tidy check.
+func (c GoCmd) runModTidy(ctx context.Context) (err error) {
+	*c.diags = DiagnosticReport{}
+
+	out, err := c.output(ctx, c.args)
+	if err == nil {
+		return nil
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || len(out) == 0 {
+		return err
+	}
+
+	c.diags.Diff = string(out)
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		fp, ok := strings.CutPrefix(sc.Text(), "--- ")
+		if !ok {
+			continue
+		}
+		// go mod tidy -diff labels the files "current/go.mod" and so on.
+		fp = strings.TrimPrefix(strings.Fields(fp)[0], "current/")
+		c.diags.Diagnostics = append(c.diags.Diagnostics, Diagnostic{
+			File:    filepath.Join(c.cwd, fp),
+			Message: "file is not tidy",
+		})
+	}
+	buildgo.Stdout(ctx).Write(out)
+
+	return errors.New("go.mod or go.sum is not tidy")
+}
+
+// diagnosticRe matches a line of the form "file:line[:column]: message".
+var diagnosticRe = regexp.MustCompile(`^(\S+?\.\w+):(\d+)(?::(\d+))?: (.+)$`)
+
+// parseDiagnostics parses the diagnostics in the output of go vet or go
+// generate. Relative file paths are resolved against dir.
+func parseDiagnostics(r io.Reader, dir string) (diags []Diagnostic) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		m := diagnosticRe.FindStringSubmatch(sc.Text())
+		if m == nil {
+			continue
+		}
+
+		d := Diagnostic{
+			File:    m[1],
+			Message: m[4],
+		}
+		if !filepath.IsAbs(d.File) && dir != "" {
+			d.File = filepath.Join(dir, d.File)
+		}
+		d.Line, _ = strconv.Atoi(m[2])
+		if m[3] != "" {
+			d.Column, _ = strconv.Atoi(m[3])
+		}
+		diags = append(diags, d)
+	}
+
+	return diags
+}
@@ -0,0 +1,59 @@
+package cmdgo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	out := "# example.com/b\n" +
+		"# [example.com/b]\n" +
+		"b/b.go:3:30: fmt.Printf format %d has arg \"x\" of wrong type string\n" +
+		"gen.go:4: running \"stringer\": exec: \"stringer\": executable file not found in $PATH\n"
+
+	diags := parseDiagnostics(strings.NewReader(out), "/src")
+
+	expected := []Diagnostic{
+		{File: "/src/b/b.go", Line: 3, Column: 30, Message: "fmt.Printf format %d has arg \"x\" of wrong type string"},
+		{File: "/src/gen.go", Line: 4, Message: "running \"stringer\": exec: \"stringer\": executable file not found in $PATH"},
+	}
+	test.AssertEqual(t, "Unexpected diagnostics", expected, diags)
+	test.AssertEqual(t, "Unexpected string", "/src/gen.go:4: "+expected[1].Message, diags[1].String())
+}
+
+func TestFmtCheckCmd(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for name, src := range map[string]string{
+		"ok.go":       "package main\n",
+		"not ok.go":   "package main\nfunc  main() {}\n",
+		"also bad.go": "package main\nvar  x = 1\n",
+	} {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644)
+		test.NilErr(t, err)
+	}
+
+	cmd, err := NewFmtCheckCmd(dir, []string{"."}, nil)
+	test.NilErr(t, err)
+	err = cmd.Run(context.Background())
+	test.Assert(t, "Expected the check to fail", err != nil)
+
+	diags := cmd.Report().(*DiagnosticReport)
+	var files []string
+	for _, d := range diags.Diagnostics {
+		files = append(files, d.File)
+	}
+	slices.Sort(files)
+	expected := []string{filepath.Join(dir, "also bad.go"), filepath.Join(dir, "not ok.go")}
+	test.AssertEqual(t, "Unexpected files", expected, files)
+	test.Assert(t, "Expected a diff", strings.Contains(diags.Diff, "func main() {}"))
+}
@@ -1,26 +1,46 @@
 package cmdgo
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	buildgo "github.com/Genekkion/build.go/v1"
 )
 
+const (
+	kindBuild    = "build"
+	kindRun      = "run"
+	kindTest     = "test"
+	kindVet      = "vet"
+	kindGenerate = "generate"
+	kindFmt      = "gofmt"
+	kindModTidy  = "go mod tidy"
+)
+
 // GoCmd represents a go command.
 type GoCmd struct {
 	cfg     Config
+	kind    string
 	cwd     string
 	targets []string
 	args    []string
+	report  *TestReport
+	diags   *DiagnosticReport
+	// packages are the import paths the targets resolved to.
+	packages []string
 }
 
 // NewBuildCmd creates a new go build command.
 func NewBuildCmd(cwd string, targets []string, args []string, opts ...Option) (cmd *GoCmd, err error) {
-	cmd, err = newCmd(cwd, targets, args, opts...)
+	cmd, err = newCmd(kindBuild, cwd, targets, args, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -34,7 +54,8 @@ func NewBuildCmd(cwd string, targets []string, args []string, opts ...Option) (c
 
 	args = append([]string{
 		cmd.cfg.compilerPath, "build",
-	}, cmd.args...)
+	}, cmd.cfg.flags()...)
+	args = append(args, cmd.args...)
 	args = append(args, cmd.targets...)
 	cmd.args = args
 
@@ -43,7 +64,7 @@ func NewBuildCmd(cwd string, targets []string, args []string, opts ...Option) (c
 
 // NewRunCmd creates a new go run command.
 func NewRunCmd(cwd string, targets []string, args []string, opts ...Option) (cmd *GoCmd, err error) {
-	cmd, err = newCmd(cwd, targets, args, opts...)
+	cmd, err = newCmd(kindRun, cwd, targets, args, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -57,8 +78,8 @@ func NewRunCmd(cwd string, targets []string, args []string, opts ...Option) (cmd
 
 	args = append([]string{
 		cmd.cfg.compilerPath, "run",
-	}, cmd.args...,
-	)
+	}, cmd.cfg.flags()...)
+	args = append(args, cmd.args...)
 	args = append(args, cmd.targets...)
 	cmd.args = args
 
@@ -67,7 +88,7 @@ func NewRunCmd(cwd string, targets []string, args []string, opts ...Option) (cmd
 
 // NewTestCmd creates a new go test command.
 func NewTestCmd(cwd string, targets []string, args []string, opts ...Option) (cmd *GoCmd, err error) {
-	cmd, err = newCmd(cwd, targets, args, opts...)
+	cmd, err = newCmd(kindTest, cwd, targets, args, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -81,29 +102,91 @@ func NewTestCmd(cwd string, targets []string, args []string, opts ...Option) (cm
 
 	args = append([]string{
 		cmd.cfg.compilerPath, "test",
-	}, cmd.args...)
+	}, cmd.cfg.flags()...)
+	args = append(args, cmd.args...)
 	args = append(args, cmd.targets...)
 	cmd.args = args
 
 	return cmd, nil
 }
 
+// NewTestBinaryCmd creates a new command which runs a precompiled test binary,
+// e.g. one built with go test -c, through go tool test2json. The results are
+// collected into a TestReport as with WithTestReport. The package is the
+// import path the binary was built from, used to label the results.
+func NewTestBinaryCmd(cwd string, pkg string, binary string, args []string, opts ...Option) (cmd *GoCmd, err error) {
+	if binary == "" {
+		return nil, errors.New("binary is required")
+	}
+
+	cmd = &GoCmd{
+		cfg:     defaultConfig(),
+		kind:    kindTest,
+		cwd:     cwd,
+		targets: []string{binary},
+		report:  &TestReport{},
+	}
+	for _, opt := range opts {
+		opt(&cmd.cfg)
+	}
+	if len(cmd.cfg.flags()) > 0 {
+		return nil, errors.New("build options are not supported for test binaries")
+	}
+
+	err = cmd.cfg.validate(kindTest, args)
+	if err != nil {
+		return nil, err
+	}
+
+	buildgo.Logger.Debug("Go test binary command created",
+		"compilerPath", cmd.cfg.compilerPath,
+		"cwd", cmd.cwd,
+		"package", pkg,
+		"binary", binary,
+		"args", args,
+	)
+
+	cmd.args = append([]string{
+		cmd.cfg.compilerPath, "tool", "test2json", "-t", "-p", pkg,
+		binary, "-test.v=test2json",
+	}, args...)
+
+	return cmd, nil
+}
+
 // newCmd creates a new go command.
-func newCmd(cwd string, targets []string, args []string, opts ...Option) (cmd *GoCmd, err error) {
-	if len(targets) == 0 {
+func newCmd(kind string, cwd string, targets []string, args []string, opts ...Option) (cmd *GoCmd, err error) {
+	if len(targets) == 0 && kind != kindModTidy {
 		return nil, errors.New("target is required")
 	}
 
 	cmd = &GoCmd{
 		cfg:     defaultConfig(),
+		kind:    kind,
 		cwd:     cwd,
-		targets: targets,
+		targets: slices.Clone(targets),
 		args:    args,
 	}
 	for _, opt := range opts {
 		opt(&cmd.cfg)
 	}
 
+	err = cmd.cfg.validate(kind, args)
+	if err != nil {
+		return nil, err
+	}
+	if cmd.cfg.testReport {
+		cmd.report = &TestReport{}
+	}
+
+	switch kind {
+	case kindVet, kindGenerate, kindFmt, kindModTidy:
+		cmd.diags = &DiagnosticReport{}
+	}
+	if kind == kindFmt || kind == kindModTidy {
+		return cmd, nil
+	}
+
 	err = cmd.setupTargets()
 	if err != nil {
 		return nil, err
@@ -112,53 +195,224 @@ func newCmd(cwd string, targets []string, args []string, opts ...Option) (cmd *G
 	return cmd, nil
 }
 
-// setupTargets recursively collects all files in the target directory. Warning: if the target is a directory, it cannot
-// have any other targets apart from the directory itself.
+// setupTargets normalises the targets into package patterns, or expands
+// directories into their go files with WithFileTargets, and checks with go list
+// that they resolve to packages.
 func (c *GoCmd) setupTargets() (err error) {
-	for _, target := range c.targets {
-		stat, err := os.Stat(target)
+	if c.cfg.fileTargets {
+		err = c.expandFileTargets()
 		if err != nil {
 			return err
-		} else if !stat.IsDir() {
+		}
+	} else {
+		for i, target := range c.targets {
+			c.targets[i] = c.normalizeTarget(target)
+		}
+	}
+
+	pkgs, err := c.goList(context.Background(), append([]string{"-e"}, c.listTargets()...)...)
+	if err != nil {
+		return fmt.Errorf("unable to resolve targets %v: %w", c.targets, err)
+	}
+
+	var errs []error
+	c.packages = make([]string, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		// Packages with syntax errors still have files, and are left for the
+		// command itself to report.
+		if pkg.Error != nil && len(pkg.GoFiles)+len(pkg.CgoFiles)+len(pkg.TestGoFiles)+len(pkg.XTestGoFiles) == 0 {
+			errs = append(errs, errors.New(pkg.Error.Err))
 			continue
 		}
+		c.packages = append(c.packages, pkg.ImportPath)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid targets: %w", errors.Join(errs...))
+	} else if len(c.packages) == 0 {
+		return fmt.Errorf("targets %v matched no packages", c.targets)
+	} else if c.kind == kindRun && len(c.packages) != 1 {
+		return fmt.Errorf("go run requires exactly 1 package, targets %v matched %d", c.targets, len(c.packages))
+	}
 
-		// target is a directory
-		if len(c.targets) != 1 {
-			return errors.New("directory target must have exactly one argument")
+	return nil
+}
+
+// normalizeTarget returns the target as a package pattern. Relative directory
+// paths such as "cmd/app" are otherwise taken to be import paths by go, and
+// are prefixed with "./".
+func (c *GoCmd) normalizeTarget(target string) string {
+	if filepath.IsAbs(target) || strings.HasPrefix(target, ".") || strings.HasSuffix(target, ".go") {
+		return target
+	}
+
+	dir, _, _ := strings.Cut(target, "...")
+	stat, err := os.Stat(filepath.Join(c.cwd, filepath.FromSlash(dir)))
+	if err != nil || !stat.IsDir() {
+		return target
+	}
+
+	return "./" + target
+}
+
+// expandFileTargets replaces directory targets with the go files directly
+// inside them, excluding test files unless this is a test command.
+func (c *GoCmd) expandFileTargets() (err error) {
+	targets := make([]string, 0, len(c.targets))
+	for _, target := range c.targets {
+		stat, err := os.Stat(filepath.Join(c.cwd, target))
+		if err != nil {
+			return err
+		} else if !stat.IsDir() {
+			targets = append(targets, target)
+			continue
 		}
 
-		files, err := os.ReadDir(target)
+		files, err := os.ReadDir(filepath.Join(c.cwd, target))
 		if err != nil {
 			return err
 		}
 
-		c.targets = make([]string, 0, len(files))
 		for _, file := range files {
-			if file.IsDir() {
+			name := file.Name()
+			if file.IsDir() || !strings.HasSuffix(name, ".go") ||
+				(strings.HasSuffix(name, "_test.go") && c.kind != kindTest) {
 				continue
 			}
 
-			c.targets = append(c.targets, filepath.Join(target, file.Name()))
+			targets = append(targets, filepath.Join(target, name))
 		}
-		return nil
 	}
 
+	c.targets = targets
 	return nil
 }
 
+// Packages returns the import paths the targets resolved to.
+func (c *GoCmd) Packages() []string {
+	return c.packages
+}
+
 // Run runs the go command.
 func (c GoCmd) Run(ctx context.Context) error {
+	switch c.kind {
+	case kindFmt:
+		return c.runFmt(ctx)
+	case kindModTidy:
+		return c.runModTidy(ctx)
+	}
+
 	args := c.args
-	buildgo.Logger.Debug("Running go command",
+	if c.cfg.templates {
+		expanded, err := buildgo.ExpandArgs(ctx, c.args)
+		if err != nil {
+			return err
+		}
+		args = expanded
+	}
+	env := c.cfg.environ()
+	if c.cfg.coverage != "" {
+		dir := CoverageDir(c.cfg.coverage)
+		err := os.RemoveAll(dir)
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(dir, 0o755)
+		if err != nil {
+			return err
+		}
+
+		switch c.kind {
+		case kindTest:
+			args = append(slices.Clone(args), "-args", "-test.gocoverdir="+dir)
+		case kindRun:
+			env = append(env, CoverageEnv(dir))
+		}
+	}
+	buildgo.Logger.DebugContext(ctx, "Running go command",
 		"cwd", c.cwd,
 		"args", args,
 	)
 
 	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
 	cmd.Dir = c.cwd
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Env = slices.Concat(os.Environ(), env, buildgo.Environ(ctx))
+
+	run := c.cfg.success.Start()
+	if c.diags != nil {
+		*c.diags = DiagnosticReport{}
+		var stderr bytes.Buffer
+		cmd.Stdout = run.Stdout(buildgo.Stdout(ctx))
+		cmd.Stderr = run.Stderr(io.MultiWriter(buildgo.Stderr(ctx), &stderr))
 
-	return cmd.Run()
+		err := run.Result(cmd.Run())
+		c.diags.Diagnostics = parseDiagnostics(&stderr, c.cwd)
+		return err
+	}
+
+	cmd.Stderr = run.Stderr(buildgo.Stderr(ctx))
+	if c.report == nil {
+		cmd.Stdout = run.Stdout(buildgo.Stdout(ctx))
+		return run.Result(cmd.Run())
+	}
+
+	*c.report = TestReport{}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	parseErr := parseTestEvents(stdout, run.Stdout(buildgo.Stdout(ctx)), c.report)
+	if parseErr != nil {
+		io.Copy(io.Discard, stdout)
+	}
+	err = run.Result(cmd.Wait())
+	if err != nil {
+		if failed := len(c.report.Failed()); failed > 0 {
+			return fmt.Errorf("%d tests failed: %w", failed, err)
+		}
+		return err
+	}
+
+	return parseErr
+}
+
+// Report returns the TestReport of the last run if the command was created
+// with WithTestReport or NewTestBinaryCmd, or the DiagnosticReport for vet,
+// generate and the checks.
+func (c GoCmd) Report() any {
+	if c.report != nil {
+		return c.report
+	} else if c.diags != nil {
+		return c.diags
+	}
+	return nil
+}
+
+// String returns the command line of the go command.
+func (c GoCmd) String() string {
+	return strings.Join(c.args, " ")
+}
+
+// Fingerprint returns a hash of the command line and environment, so that a
+// change in options causes the step to be rebuilt.
+func (c GoCmd) Fingerprint() []byte {
+	h := buildgo.Hasher()
+	for _, part := range [][]string{
+		{c.cwd},
+		c.args,
+		c.cfg.environ(),
+		{c.cfg.coverage},
+	} {
+		for _, s := range part {
+			h.Write([]byte(s))
+			h.Write([]byte{0})
+		}
+		h.Write([]byte{1})
+	}
+	return h.Sum(nil)
 }
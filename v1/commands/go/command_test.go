@@ -0,0 +1,49 @@
+package cmdgo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestNormalizeTarget(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "cmd", "app"), 0o755)
+	test.NilErr(t, err)
+
+	c := &GoCmd{cwd: dir}
+	tests := map[string]string{
+		"cmd/app":          "./cmd/app",
+		"cmd/...":          "./cmd/...",
+		"./cmd/app":        "./cmd/app",
+		"main.go":          "main.go",
+		"example.com/pkg":  "example.com/pkg",
+		"fmt":              "fmt",
+		filepath.Join(dir): filepath.Join(dir),
+	}
+	for target, expected := range tests {
+		test.AssertEqual(t, "Unexpected target for "+target, expected, c.normalizeTarget(target))
+	}
+}
+
+func TestNewCmd_Targets(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "cmd", "app"), 0o755)
+	test.NilErr(t, err)
+	err = os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module app\n\ngo 1.21\n"), 0o644)
+	test.NilErr(t, err)
+	err = os.WriteFile(filepath.Join(dir, "cmd", "app", "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644)
+	test.NilErr(t, err)
+
+	targets := []string{"cmd/app"}
+	cmd, err := NewBuildCmd(dir, targets, nil)
+	test.NilErr(t, err)
+	test.AssertEqual(t, "targets", []string{"./cmd/app"}, cmd.targets)
+	test.AssertEqual(t, "caller's targets", []string{"cmd/app"}, targets)
+}
@@ -0,0 +1,293 @@
+package cmdgo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	buildgo "github.com/Genekkion/build.go/v1"
+)
+
+// coverageRoot returns the directory all coverage data is kept under.
+func coverageRoot() string {
+	return filepath.Join(buildgo.CacheDir, "coverage")
+}
+
+// CoverageDir returns the directory coverage data collected under the given
+// name is written to.
+func CoverageDir(name string) string {
+	name = regexp.MustCompile(`[^A-Za-z0-9._-]+`).ReplaceAllString(name, "_")
+	return filepath.Join(coverageRoot(), "steps", name)
+}
+
+// CoverageEnv returns the GOCOVERDIR environment variable for running a binary
+// built with WithCover, in the form "KEY=value".
+func CoverageEnv(dir string) string {
+	return "GOCOVERDIR=" + dir
+}
+
+// PackageCoverage represents the statement coverage of a package.
+type PackageCoverage struct {
+	Package string
+	Percent float64
+}
+
+// CoverageReport represents the merged coverage of several steps.
+type CoverageReport struct {
+	// Profile is the path of the combined profile, in the format of go test
+	// -coverprofile.
+	Profile  string
+	Packages []PackageCoverage
+	// BelowThreshold are the packages with less coverage than required.
+	BelowThreshold []PackageCoverage
+}
+
+// CoverageConfig represents the configuration of a coverage command.
+type CoverageConfig struct {
+	compilerPath string
+	profile      string
+	summary      string
+	minPercent   float64
+	pkgPercent   map[string]float64
+}
+
+// defaultCoverageConfig returns the default coverage configuration.
+func defaultCoverageConfig() CoverageConfig {
+	return CoverageConfig{
+		compilerPath: defaultConfig().compilerPath,
+		profile:      filepath.Join(coverageRoot(), "coverage.out"),
+		summary:      filepath.Join(coverageRoot(), "summary.txt"),
+		pkgPercent:   map[string]float64{},
+	}
+}
+
+// CoverageOption represents a coverage option.
+type CoverageOption func(*CoverageConfig)
+
+// WithCoverageCompilerPath sets the compiler path.
+func WithCoverageCompilerPath(path string) CoverageOption {
+	return func(cfg *CoverageConfig) {
+		cfg.compilerPath = path
+	}
+}
+
+// WithProfile sets the path the combined profile is written to.
+func WithProfile(fp string) CoverageOption {
+	return func(cfg *CoverageConfig) {
+		cfg.profile = fp
+	}
+}
+
+// WithSummary sets the path the per-package summary is written to.
+func WithSummary(fp string) CoverageOption {
+	return func(cfg *CoverageConfig) {
+		cfg.summary = fp
+	}
+}
+
+// WithMinCoverage fails the command when any package has less than the given
+// percentage of statements covered.
+func WithMinCoverage(percent float64) CoverageOption {
+	return func(cfg *CoverageConfig) {
+		cfg.minPercent = percent
+	}
+}
+
+// WithPackageMinCoverage overrides the minimum coverage for a single package.
+func WithPackageMinCoverage(pkg string, percent float64) CoverageOption {
+	return func(cfg *CoverageConfig) {
+		cfg.pkgPercent[pkg] = percent
+	}
+}
+
+// CoverageCmd merges the coverage collected by several steps with go tool
+// covdata.
+type CoverageCmd struct {
+	cfg    CoverageConfig
+	names  []string
+	report *CoverageReport
+}
+
+// NewCoverageCmd creates a new command which merges the coverage collected
+// under the given names, see WithCoverage. It writes a combined profile and a
+// per-package summary.
+func NewCoverageCmd(names []string, opts ...CoverageOption) (cmd *CoverageCmd, err error) {
+	if len(names) == 0 {
+		return nil, errors.New("at least 1 name is required")
+	}
+
+	cfg := defaultCoverageConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &CoverageCmd{
+		cfg:    cfg,
+		names:  names,
+		report: &CoverageReport{},
+	}, nil
+}
+
+// Run runs the command.
+func (c CoverageCmd) Run(ctx context.Context) (err error) {
+	*c.report = CoverageReport{}
+
+	var inputs []string
+	for _, name := range c.names {
+		dir := CoverageDir(name)
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) == 0 {
+			buildgo.Logger.WarnContext(ctx, "No coverage data found",
+				"name", name,
+				"dir", dir,
+			)
+			continue
+		}
+		inputs = append(inputs, dir)
+	}
+	if len(inputs) == 0 {
+		return errors.New("no coverage data to merge")
+	}
+
+	merged := filepath.Join(coverageRoot(), "merged")
+	err = os.RemoveAll(merged)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(merged, 0o755)
+	if err != nil {
+		return err
+	}
+
+	in := "-i=" + strings.Join(inputs, ",")
+	_, err = c.covdata(ctx, "merge", in, "-o="+merged)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(c.cfg.profile), 0o755)
+	if err != nil {
+		return err
+	}
+	_, err = c.covdata(ctx, "textfmt", "-i="+merged, "-o="+c.cfg.profile)
+	if err != nil {
+		return err
+	}
+	c.report.Profile = c.cfg.profile
+
+	out, err := c.covdata(ctx, "percent", "-i="+merged)
+	if err != nil {
+		return err
+	}
+	c.report.Packages, err = parseCoveragePercent(bytes.NewReader(out))
+	if err != nil {
+		return err
+	}
+
+	var summary bytes.Buffer
+	for _, p := range c.report.Packages {
+		minPercent, ok := c.cfg.pkgPercent[p.Package]
+		if !ok {
+			minPercent = c.cfg.minPercent
+		}
+
+		mark := ""
+		if p.Percent < minPercent {
+			c.report.BelowThreshold = append(c.report.BelowThreshold, p)
+			mark = fmt.Sprintf(" (below %.1f%%)", minPercent)
+		}
+		fmt.Fprintf(&summary, "%s\t%.1f%%%s\n", p.Package, p.Percent, mark)
+	}
+
+	err = os.MkdirAll(filepath.Dir(c.cfg.summary), 0o755)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(c.cfg.summary, summary.Bytes(), 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(buildgo.Stdout(ctx), &summary)
+	if err != nil {
+		return err
+	}
+
+	buildgo.Logger.InfoContext(ctx, "Coverage merged",
+		"inputs", inputs,
+		"profile", c.cfg.profile,
+		"summary", c.cfg.summary,
+	)
+
+	if len(c.report.BelowThreshold) > 0 {
+		pkgs := make([]string, len(c.report.BelowThreshold))
+		for i, p := range c.report.BelowThreshold {
+			pkgs[i] = p.Package
+		}
+		return fmt.Errorf("coverage below threshold for %d packages: %s",
+			len(pkgs), strings.Join(pkgs, ", "))
+	}
+
+	return nil
+}
+
+// covdata runs go tool covdata, returning its output.
+func (c CoverageCmd) covdata(ctx context.Context, args ...string) (out []byte, err error) {
+	args = append([]string{"tool", "covdata"}, args...)
+	buildgo.Logger.DebugContext(ctx, "Running go command",
+		"args", args,
+	)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.cfg.compilerPath, args...)
+	cmd.Stderr = &stderr
+
+	out, err = cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go tool covdata %s: %w: %s", args[2], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// Report returns the CoverageReport of the last run.
+func (c CoverageCmd) Report() any {
+	return c.report
+}
+
+// coveragePercentRe matches a line of go tool covdata percent.
+var coveragePercentRe = regexp.MustCompile(`^\s*(\S+)\s+coverage: ([0-9.]+)% of statements`)
+
+// parseCoveragePercent parses the output of go tool covdata percent, sorted
+// by package.
+func parseCoveragePercent(r io.Reader) (pkgs []PackageCoverage, err error) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		m := coveragePercentRe.FindStringSubmatch(sc.Text())
+		if m == nil {
+			continue
+		}
+
+		percent, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, PackageCoverage{
+			Package: m[1],
+			Percent: percent,
+		})
+	}
+
+	slices.SortFunc(pkgs, func(a, b PackageCoverage) int {
+		return strings.Compare(a.Package, b.Package)
+	})
+	return pkgs, sc.Err()
+}
@@ -0,0 +1,55 @@
+package cmdgo
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+	buildgo "github.com/Genekkion/build.go/v1"
+)
+
+func TestParseCoveragePercent(t *testing.T) {
+	t.Parallel()
+
+	out := "\texample.com/b\t\tcoverage: 0.0% of statements\n" +
+		"\texample.com/a\t\tcoverage: 66.7% of statements\n"
+
+	pkgs, err := parseCoveragePercent(strings.NewReader(out))
+	test.NilErr(t, err)
+
+	expected := []PackageCoverage{
+		{Package: "example.com/a", Percent: 66.7},
+		{Package: "example.com/b", Percent: 0},
+	}
+	test.AssertEqual(t, "Unexpected coverage", expected, pkgs)
+}
+
+func TestWithCoverage(t *testing.T) {
+	dir := writeModule(t, t.TempDir())
+	tst, err := NewTestCmd(dir, []string{"."}, nil, WithCoverage("unit"))
+	test.NilErr(t, err)
+	run, err := NewRunCmd(dir, []string{"."}, nil, WithCoverage("app"))
+	test.NilErr(t, err)
+
+	// The directories are resolved once the cache is set up, after the
+	// commands are created.
+	cacheDir := buildgo.CacheDir
+	t.Cleanup(func() {
+		buildgo.CacheDir = cacheDir
+	})
+	buildgo.CacheDir = t.TempDir()
+
+	for name, cmd := range map[string]*GoCmd{"unit": tst, "app": run} {
+		err = cmd.Run(context.Background())
+		test.NilErr(t, err)
+
+		covDir := filepath.Join(buildgo.CacheDir, "coverage", "steps", name)
+		test.AssertEqual(t, "directory of "+name, covDir, CoverageDir(name))
+		meta, err := filepath.Glob(filepath.Join(covDir, "covmeta.*"))
+		test.NilErr(t, err)
+		test.Assert(t, "Expected coverage data for "+name, len(meta) > 0)
+	}
+	test.AssertEqual(t, "env", "GOCOVERDIR=/cover", CoverageEnv("/cover"))
+}
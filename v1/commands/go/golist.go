@@ -0,0 +1,246 @@
+package cmdgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	buildgo "github.com/Genekkion/build.go/v1"
+)
+
+// listedModule is the module information reported by go list.
+type listedModule struct {
+	Path  string
+	Main  bool
+	Dir   string
+	GoMod string
+}
+
+// listedPackage is the package information reported by go list -json.
+type listedPackage struct {
+	Dir             string
+	ImportPath      string
+	Standard        bool
+	Module          *listedModule
+	GoFiles         []string
+	CgoFiles        []string
+	EmbedFiles      []string
+	TestGoFiles     []string
+	XTestGoFiles    []string
+	TestEmbedFiles  []string
+	XTestEmbedFiles []string
+	Error           *struct {
+		Err string
+	}
+}
+
+// local returns whether the package belongs to a main module, as opposed to
+// the standard library, a dependency, or the main package go test generates
+// under the build cache.
+func (p listedPackage) local() bool {
+	if p.Standard || strings.HasSuffix(p.ImportPath, ".test") {
+		return false
+	}
+	return p.Module == nil || p.Module.Main
+}
+
+// goList runs go list -json with the given flags and arguments in the
+// command's working directory, with the command's build tags and environment.
+func (c *GoCmd) goList(ctx context.Context, args ...string) (pkgs []listedPackage, err error) {
+	flags := []string{"list", "-json"}
+	if len(c.cfg.tags) > 0 {
+		flags = append(flags, "-tags", strings.Join(c.cfg.tags, ","))
+	}
+	if c.cfg.modMode != "" {
+		flags = append(flags, "-mod="+c.cfg.modMode)
+	}
+	args = append(flags, args...)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.cfg.compilerPath, args...)
+	cmd.Dir = c.cwd
+	cmd.Stderr = &stderr
+	if env := c.cfg.environ(); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return nil, err
+		}
+		return nil, errors.New(msg)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var pkg listedPackage
+		err = dec.Decode(&pkg)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		pkgs = append(pkgs, pkg)
+	}
+
+	return pkgs, nil
+}
+
+// goEnv returns the value of a go env variable in the command's working
+// directory.
+func (c *GoCmd) goEnv(ctx context.Context, key string) (v string, err error) {
+	cmd := exec.CommandContext(ctx, c.cfg.compilerPath, "env", key)
+	cmd.Dir = c.cwd
+	if env := c.cfg.environ(); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// listTargets returns the targets in a form go list accepts. Non-go files are
+// dropped when the targets are files, as go run passes them to the program
+// rather than the compiler.
+func (c *GoCmd) listTargets() []string {
+	if !slices.ContainsFunc(c.targets, func(t string) bool {
+		return strings.HasSuffix(t, ".go")
+	}) {
+		return c.targets
+	}
+
+	targets := make([]string, 0, len(c.targets))
+	for _, t := range c.targets {
+		if strings.HasSuffix(t, ".go") {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// FileDeps returns every local file the command's targets are built from, as
+// reported by go list -deps: the go, cgo and embedded files of packages in the
+// main module, along with go.mod and go.sum. Test files are included for test
+// commands.
+func (c *GoCmd) FileDeps(ctx context.Context) (files []string, err error) {
+	args := []string{"-deps"}
+	if c.kind == kindTest {
+		args = append(args, "-test")
+	}
+	args = append(args, c.listTargets()...)
+
+	pkgs, err := c.goList(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	add := func(dir string, names ...string) {
+		for _, name := range names {
+			fp := name
+			if !filepath.IsAbs(fp) {
+				fp = filepath.Join(dir, name)
+			}
+			if seen[fp] {
+				continue
+			}
+			seen[fp] = true
+			files = append(files, fp)
+		}
+	}
+
+	for _, pkg := range pkgs {
+		if !pkg.local() {
+			continue
+		}
+
+		add(pkg.Dir, pkg.GoFiles...)
+		add(pkg.Dir, pkg.CgoFiles...)
+		add(pkg.Dir, pkg.EmbedFiles...)
+		if c.kind == kindTest {
+			add(pkg.Dir, pkg.TestGoFiles...)
+			add(pkg.Dir, pkg.XTestGoFiles...)
+			add(pkg.Dir, pkg.TestEmbedFiles...)
+			add(pkg.Dir, pkg.XTestEmbedFiles...)
+		}
+		if pkg.Module != nil && pkg.Module.GoMod != "" {
+			add("", pkg.Module.GoMod)
+		}
+	}
+
+	goMod, err := c.goEnv(ctx, "GOMOD")
+	if err != nil {
+		return nil, err
+	}
+	if goMod != "" && goMod != os.DevNull {
+		add("", goMod)
+	}
+
+	for _, fp := range slices.Clone(files) {
+		if filepath.Base(fp) != "go.mod" {
+			continue
+		}
+
+		sum := filepath.Join(filepath.Dir(fp), "go.sum")
+		_, err = os.Stat(sum)
+		if err == nil {
+			add("", sum)
+		}
+	}
+
+	slices.Sort(files)
+	buildgo.Logger.Debug("Go file dependencies resolved",
+		"targets", c.targets,
+		"files", files,
+	)
+
+	return files, nil
+}
+
+// AddFileDeps resolves the file dependencies of the go commands and adds them
+// to the step, so that the step is rebuilt exactly when the package graph of
+// its targets changes.
+func AddFileDeps(ctx context.Context, step *buildgo.Step, cmds ...*GoCmd) (err error) {
+	for _, cmd := range cmds {
+		files, err := cmd.FileDeps(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := range files {
+			files[i] = escapeGlob(files[i])
+		}
+		step.AddFileDeps(files...)
+	}
+
+	return nil
+}
+
+// escapeGlob escapes the meta characters of filepath.Match in fp.
+func escapeGlob(fp string) string {
+	if !strings.ContainsAny(fp, `*?[\`) || filepath.Separator == '\\' {
+		return fp
+	}
+
+	var b strings.Builder
+	for _, r := range fp {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
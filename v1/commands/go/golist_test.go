@@ -0,0 +1,101 @@
+package cmdgo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+	buildgo "github.com/Genekkion/build.go/v1"
+)
+
+// writeModule writes an app module importing a local package, the standard
+// library and a dependency replaced by a directory next to it, returning the
+// app module's directory.
+func writeModule(t *testing.T, root string) (dir string) {
+	t.Helper()
+
+	files := map[string]string{
+		"app/go.mod": "module app\n\ngo 1.21\n\nrequire example.com/dep v0.0.0\n\n" +
+			"replace example.com/dep => ../dep\n",
+		"app/main.go": "package main\n\nimport (\n\t\"fmt\"\n\n\t\"app/lib\"\n\t\"example.com/dep\"\n)\n\n" +
+			"func main() {\n\tfmt.Println(lib.Name, dep.Name)\n}\n",
+		"app/main_test.go": "package main\n\nimport \"testing\"\n\nfunc TestApp(t *testing.T) {}\n",
+		"app/lib/lib.go":   "package lib\n\nconst Name = \"lib\"\n",
+		"dep/go.mod":       "module example.com/dep\n\ngo 1.21\n",
+		"dep/dep.go":       "package dep\n\nconst Name = \"dep\"\n",
+	}
+	for name, content := range files {
+		fp := filepath.Join(root, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(fp), 0o755)
+		test.NilErr(t, err)
+		err = os.WriteFile(fp, []byte(content), 0o644)
+		test.NilErr(t, err)
+	}
+
+	return filepath.Join(root, "app")
+}
+
+func TestFileDeps(t *testing.T) {
+	t.Parallel()
+
+	dir := writeModule(t, t.TempDir())
+	ctx := context.Background()
+	expected := []string{
+		filepath.Join(dir, "go.mod"),
+		filepath.Join(dir, "lib", "lib.go"),
+		filepath.Join(dir, "main.go"),
+	}
+
+	build, err := NewBuildCmd(dir, []string{"."}, nil)
+	test.NilErr(t, err)
+	files, err := build.FileDeps(ctx)
+	test.NilErr(t, err)
+	test.AssertEqual(t, "build files", expected, files)
+
+	tst, err := NewTestCmd(dir, []string{"."}, nil)
+	test.NilErr(t, err)
+	files, err = tst.FileDeps(ctx)
+	test.NilErr(t, err)
+	expected = append(expected, filepath.Join(dir, "main_test.go"))
+	test.AssertEqual(t, "test files", expected, files)
+}
+
+func TestAddFileDeps(t *testing.T) {
+	t.Parallel()
+
+	dir := writeModule(t, filepath.Join(t.TempDir(), "src[1]"))
+	build, err := NewBuildCmd(dir, []string{"."}, nil)
+	test.NilErr(t, err)
+
+	step := buildgo.NewStep("build", build)
+	err = AddFileDeps(context.Background(), step, build)
+	test.NilErr(t, err)
+
+	patterns := step.FileDeps()
+	test.AssertEqual(t, "patterns", 3, len(patterns))
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		test.NilErr(t, err)
+		test.AssertEqual(t, "matches of "+pattern, 1, len(matches))
+	}
+}
+
+func TestEscapeGlob(t *testing.T) {
+	t.Parallel()
+
+	if filepath.Separator == '\\' {
+		t.Skip("filepath.Match does not support escaping on windows")
+	}
+
+	tests := map[string]string{
+		"/src/main.go":       "/src/main.go",
+		"/src[1]/main.go":    `/src\[1]/main.go`,
+		"/src/*?.go":         `/src/\*\?.go`,
+		`/src/back\slash.go`: `/src/back\\slash.go`,
+	}
+	for fp, expected := range tests {
+		test.AssertEqual(t, "Unexpected pattern for "+fp, expected, escapeGlob(fp))
+	}
+}
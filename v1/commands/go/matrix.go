@@ -0,0 +1,153 @@
+package cmdgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	buildgo "github.com/Genekkion/build.go/v1"
+	"github.com/Genekkion/build.go/v1/commands/inline"
+)
+
+// DefaultMatrixOutput is the default output path template of a matrix build.
+const DefaultMatrixOutput = "dist/{{.Name}}_{{.GOOS}}_{{.GOARCH}}{{.Ext}}"
+
+// Platform represents a target platform.
+type Platform struct {
+	GOOS   string
+	GOARCH string
+	GOARM  string
+}
+
+// ParsePlatform parses a platform in the form "goos/goarch" or
+// "goos/goarch/goarm", e.g. "linux/arm/7".
+func ParsePlatform(s string) (p Platform, err error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, fmt.Errorf("invalid platform: %q", s)
+	}
+
+	p = Platform{
+		GOOS:   parts[0],
+		GOARCH: parts[1],
+	}
+	if len(parts) == 3 {
+		p.GOARM = parts[2]
+	}
+	return p, nil
+}
+
+// String returns the platform in the form accepted by ParsePlatform.
+func (p Platform) String() string {
+	s := p.GOOS + "/" + p.GOARCH
+	if p.GOARM != "" {
+		s += "/" + p.GOARM
+	}
+	return s
+}
+
+// MatrixBase describes the build to be run for every platform of a matrix.
+type MatrixBase struct {
+	// Name of the build, used for the step names and output paths.
+	Name string
+	// Cwd, Targets and Args are as for NewBuildCmd.
+	Cwd     string
+	Targets []string
+	Args    []string
+	// Output is the output path template, defaulting to DefaultMatrixOutput.
+	// It is executed with the fields Name, GOOS, GOARCH, GOARM and Ext, which
+	// is ".exe" for windows and empty otherwise.
+	Output string
+	// Options are applied to every variant, before the platform options.
+	Options []Option
+}
+
+// matrixData is the data the output path template is executed with.
+type matrixData struct {
+	Name   string
+	GOOS   string
+	GOARCH string
+	GOARM  string
+	Ext    string
+}
+
+// Matrix expands base into a go build step per platform, named
+// "<name>:<platform>". The returned aggregate step, named after base, depends
+// on all of them, so that running it builds the variants in parallel.
+func Matrix(base MatrixBase, platforms ...Platform) (variants []*buildgo.Step, all *buildgo.Step, err error) {
+	if base.Name == "" {
+		return nil, nil, errors.New("name is required")
+	} else if len(platforms) == 0 {
+		return nil, nil, errors.New("at least 1 platform is required")
+	}
+
+	output := base.Output
+	if output == "" {
+		output = DefaultMatrixOutput
+	}
+	tmpl, err := template.New(base.Name).Option("missingkey=error").Parse(output)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	outputs := map[string]string{}
+	for _, p := range platforms {
+		data := matrixData{
+			Name:   base.Name,
+			GOOS:   p.GOOS,
+			GOARCH: p.GOARCH,
+			GOARM:  p.GOARM,
+		}
+		if p.GOOS == "windows" {
+			data.Ext = ".exe"
+		}
+
+		var b strings.Builder
+		err = tmpl.Execute(&b, data)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		fp := filepath.Clean(b.String())
+		if prev, ok := outputs[fp]; ok {
+			return nil, nil, fmt.Errorf("platforms %s and %s have the same output path: %s", prev, p, fp)
+		}
+		outputs[fp] = p.String()
+
+		opts := append([]Option{}, base.Options...)
+		opts = append(opts,
+			WithGOOS(p.GOOS),
+			WithGOARCH(p.GOARCH),
+			WithOutput(fp),
+		)
+		if p.GOARM != "" {
+			opts = append(opts, WithGOARM(p.GOARM))
+		}
+
+		cmd, err := NewBuildCmd(base.Cwd, base.Targets, base.Args, opts...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("platform %s: %w", p, err)
+		}
+
+		variants = append(variants, buildgo.NewStep(base.Name+":"+p.String(), cmd))
+	}
+
+	cmd, err := inline.NewCmd([]inline.CmdFunc{
+		func(ctx context.Context) error {
+			buildgo.Logger.InfoContext(ctx, "Matrix build completed",
+				"name", base.Name,
+				"variants", len(variants),
+			)
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	all = buildgo.NewStep(base.Name, cmd).DependsOn(variants...)
+
+	return variants, all, nil
+}
@@ -0,0 +1,80 @@
+package cmdgo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+	buildgo "github.com/Genekkion/build.go/v1"
+)
+
+func TestParsePlatform(t *testing.T) {
+	t.Parallel()
+
+	p, err := ParsePlatform("linux/arm/7")
+	test.NilErr(t, err)
+	test.AssertEqual(t, "Unexpected platform", Platform{GOOS: "linux", GOARCH: "arm", GOARM: "7"}, p)
+	test.AssertEqual(t, "Unexpected string", "linux/arm/7", p.String())
+
+	for _, s := range []string{"linux", "linux/", "/amd64", "a/b/c/d"} {
+		_, err = ParsePlatform(s)
+		test.Assert(t, "Expected error for "+s, err != nil)
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	t.Parallel()
+
+	dir := writeModule(t, t.TempDir())
+	platforms := []Platform{
+		{GOOS: "linux", GOARCH: "amd64"},
+		{GOOS: "linux", GOARCH: "arm", GOARM: "7"},
+		{GOOS: "windows", GOARCH: "amd64"},
+	}
+	variants, all, err := Matrix(MatrixBase{
+		Name:    "app",
+		Cwd:     dir,
+		Targets: []string{"."},
+	}, platforms...)
+	test.NilErr(t, err)
+
+	expected := map[string]string{
+		"app:linux/amd64":   filepath.Join("dist", "app_linux_amd64"),
+		"app:linux/arm/7":   filepath.Join("dist", "app_linux_arm"),
+		"app:windows/amd64": filepath.Join("dist", "app_windows_amd64.exe"),
+	}
+	test.AssertEqual(t, "variants", len(platforms), len(variants))
+	for _, v := range variants {
+		cmd := v.Commands()[0].(*GoCmd)
+		test.AssertEqual(t, "output of "+v.Name(), expected[v.Name()], cmd.cfg.output)
+	}
+	test.AssertEqual(t, "aggregate", "app", all.Name())
+
+	err = all.Run(context.Background())
+	test.NilErr(t, err)
+	for _, v := range variants {
+		test.AssertEqual(t, "status of "+v.Name(), buildgo.StatusSucceeded, v.Result().Status)
+		_, err = os.Stat(filepath.Join(dir, expected[v.Name()]))
+		test.NilErr(t, err)
+	}
+}
+
+func TestMatrix_Invalid(t *testing.T) {
+	t.Parallel()
+
+	linux := Platform{GOOS: "linux", GOARCH: "amd64"}
+	_, _, err := Matrix(MatrixBase{Name: "app", Targets: []string{"."}, Output: "dist/{{.Name}}_{{.GOOS}}"},
+		linux, Platform{GOOS: "linux", GOARCH: "arm64"})
+	test.Assert(t, "Expected duplicate outputs to fail",
+		err != nil && strings.Contains(err.Error(), "same output path"))
+
+	_, _, err = Matrix(MatrixBase{Targets: []string{"."}}, linux)
+	test.Assert(t, "Expected missing name to fail", err != nil)
+	_, _, err = Matrix(MatrixBase{Name: "app", Targets: []string{"."}})
+	test.Assert(t, "Expected missing platforms to fail", err != nil)
+	_, _, err = Matrix(MatrixBase{Name: "app", Targets: []string{"."}, Output: "{{.Missing}}"}, linux)
+	test.Assert(t, "Expected unknown template fields to fail", err != nil)
+}
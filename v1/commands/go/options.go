@@ -1,15 +1,42 @@
 package cmdgo
 
 import (
+	"errors"
 	"fmt"
 	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
 
+	"github.com/Genekkion/build.go/internal/success"
 	buildgo "github.com/Genekkion/build.go/v1"
+	"github.com/Genekkion/build.go/v1/vcs"
 )
 
 // Config represents the configuration.
 type Config struct {
 	compilerPath string
+	output       string
+	tags         []string
+	ldflags      []string
+	race         bool
+	trimpath     bool
+	cgo          *bool
+	goos         string
+	goarch       string
+	goarm        string
+	env          []string
+	goflags      []string
+	modMode      string
+	testReport   bool
+	cover        bool
+	coverPkg     []string
+	coverage     string
+	fileTargets  bool
+	templates    bool
+	success      success.Policy
+	// errs are errors of invalid options, reported by validate.
+	errs []error
 }
 
 // defaultConfig returns the default configuration.
@@ -31,6 +58,144 @@ func defaultConfig() Config {
 	}
 }
 
+// flags returns the command line flags for the typed options.
+func (cfg Config) flags() (flags []string) {
+	if cfg.output != "" {
+		flags = append(flags, "-o", cfg.output)
+	}
+	if len(cfg.tags) > 0 {
+		flags = append(flags, "-tags", strings.Join(cfg.tags, ","))
+	}
+	if len(cfg.ldflags) > 0 {
+		flags = append(flags, "-ldflags", strings.Join(cfg.ldflags, " "))
+	}
+	if cfg.race {
+		flags = append(flags, "-race")
+	}
+	if cfg.trimpath {
+		flags = append(flags, "-trimpath")
+	}
+	if cfg.modMode != "" {
+		flags = append(flags, "-mod="+cfg.modMode)
+	}
+	if cfg.testReport {
+		flags = append(flags, "-json")
+	}
+	if cfg.cover || cfg.coverage != "" {
+		flags = append(flags, "-cover")
+	}
+	if len(cfg.coverPkg) > 0 {
+		flags = append(flags, "-coverpkg="+strings.Join(cfg.coverPkg, ","))
+	}
+	return flags
+}
+
+// environ returns the environment variables for the options, to be added on
+// top of the parent environment.
+func (cfg Config) environ() (env []string) {
+	return append(cfg.typedEnviron(), cfg.env...)
+}
+
+// typedEnviron returns the environment variables for the typed options.
+func (cfg Config) typedEnviron() (env []string) {
+	if cfg.cgo != nil {
+		env = append(env, "CGO_ENABLED="+map[bool]string{true: "1", false: "0"}[*cfg.cgo])
+	}
+	if cfg.goos != "" {
+		env = append(env, "GOOS="+cfg.goos)
+	}
+	if cfg.goarch != "" {
+		env = append(env, "GOARCH="+cfg.goarch)
+	}
+	if cfg.goarm != "" {
+		env = append(env, "GOARM="+cfg.goarm)
+	}
+	if len(cfg.goflags) > 0 {
+		env = append(env, "GOFLAGS="+strings.Join(cfg.goflags, " "))
+	}
+	return env
+}
+
+// validate checks for options which conflict with each other, or with the
+// untyped arguments of a command of the given kind.
+func (cfg Config) validate(kind string, args []string) (err error) {
+	errs := slices.Clone(cfg.errs)
+
+	switch kind {
+	case kindFmt, kindModTidy:
+		if len(cfg.flags()) > 0 {
+			errs = append(errs, fmt.Errorf("build options are not supported by %s", kind))
+		}
+		if !cfg.success.IsZero() {
+			errs = append(errs, fmt.Errorf("success options are not supported by %s", kind))
+		}
+		if cfg.templates {
+			errs = append(errs, fmt.Errorf("templates are not supported by %s", kind))
+		}
+	case kindBuild, kindTest:
+	default:
+		if cfg.output != "" {
+			errs = append(errs, fmt.Errorf("output path is not supported by go %s", kind))
+		}
+	}
+	if (cfg.cover || cfg.coverage != "") && (kind == kindVet || kind == kindGenerate) {
+		errs = append(errs, fmt.Errorf("coverage is not supported by go %s", kind))
+	}
+	if cfg.testReport && kind != kindTest {
+		errs = append(errs, errors.New("test report is only supported by go test"))
+	}
+	if cfg.coverage != "" && kind == kindBuild {
+		errs = append(errs, errors.New("coverage is collected when running, use WithCover for go build"))
+	}
+	if cfg.race && cfg.cgo != nil && !*cfg.cgo {
+		errs = append(errs, errors.New("race detector requires cgo"))
+	}
+	if cfg.modMode != "" && !slices.Contains([]string{"readonly", "vendor", "mod"}, cfg.modMode) {
+		errs = append(errs, fmt.Errorf("invalid mod mode: %q", cfg.modMode))
+	}
+
+	typed := map[string]bool{
+		"-o":        cfg.output != "",
+		"-tags":     len(cfg.tags) > 0,
+		"-ldflags":  len(cfg.ldflags) > 0,
+		"-race":     cfg.race,
+		"-trimpath": cfg.trimpath,
+		"-mod":      cfg.modMode != "",
+		"-json":     cfg.testReport,
+		"-cover":    cfg.cover || cfg.coverage != "",
+		"-coverpkg": len(cfg.coverPkg) > 0,
+	}
+	for _, arg := range args {
+		name, _, _ := strings.Cut(arg, "=")
+		name = "-" + strings.TrimLeft(name, "-")
+		if typed[name] {
+			errs = append(errs, fmt.Errorf("flag %s is set by both an option and the arguments", name))
+		}
+	}
+	for _, flag := range cfg.goflags {
+		name, _, _ := strings.Cut(flag, "=")
+		name = "-" + strings.TrimLeft(name, "-")
+		if typed[name] {
+			errs = append(errs, fmt.Errorf("flag %s is set by both an option and GOFLAGS", name))
+		}
+	}
+
+	typedEnv := map[string]string{}
+	for _, kv := range cfg.typedEnviron() {
+		k, v, _ := strings.Cut(kv, "=")
+		typedEnv[k] = v
+	}
+	for _, kv := range cfg.env {
+		k, v, _ := strings.Cut(kv, "=")
+		typedV, ok := typedEnv[k]
+		if ok && typedV != v {
+			errs = append(errs, fmt.Errorf("environment variable %s is set by both an option and WithEnv", k))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 // Option represents an option.
 type Option func(*Config)
 
@@ -40,3 +205,211 @@ func WithCompilerPath(path string) Option {
 		cfg.compilerPath = path
 	}
 }
+
+// WithOutput sets the output path (-o).
+func WithOutput(fp string) Option {
+	return func(cfg *Config) {
+		cfg.output = fp
+	}
+}
+
+// WithTags adds build tags (-tags).
+func WithTags(tags ...string) Option {
+	return func(cfg *Config) {
+		cfg.tags = append(cfg.tags, tags...)
+	}
+}
+
+// WithLdflags adds linker flags (-ldflags).
+func WithLdflags(flags ...string) Option {
+	return func(cfg *Config) {
+		cfg.ldflags = append(cfg.ldflags, flags...)
+	}
+}
+
+// WithLdflagsX sets the string variable name, e.g. "main.version", to value at
+// link time (-ldflags -X). Values with both single and double quotes cannot be
+// passed to the linker, and fail validation.
+func WithLdflagsX(name string, value string) Option {
+	return func(cfg *Config) {
+		flag, err := quoteFlag(name + "=" + value)
+		if err != nil {
+			cfg.errs = append(cfg.errs, fmt.Errorf("invalid value for -X %s: %w", name, err))
+			return
+		}
+		cfg.ldflags = append(cfg.ldflags, "-X", flag)
+	}
+}
+
+// quoteFlag quotes s for use within a flag value which go splits on spaces,
+// such as -ldflags. Go has no escapes within quotes, so s cannot contain the
+// quote it is wrapped in.
+func quoteFlag(s string) (quoted string, err error) {
+	switch {
+	case !strings.ContainsAny(s, " \t\n\r") && !strings.HasPrefix(s, "'") && !strings.HasPrefix(s, `"`):
+		return s, nil
+	case !strings.Contains(s, "'"):
+		return "'" + s + "'", nil
+	case !strings.Contains(s, `"`):
+		return `"` + s + `"`, nil
+	default:
+		return "", fmt.Errorf("%q contains both single and double quotes", s)
+	}
+}
+
+// WithRace enables the race detector (-race).
+func WithRace() Option {
+	return func(cfg *Config) {
+		cfg.race = true
+	}
+}
+
+// WithTrimpath removes file system paths from the binary (-trimpath).
+func WithTrimpath() Option {
+	return func(cfg *Config) {
+		cfg.trimpath = true
+	}
+}
+
+// WithCgo enables or disables cgo (CGO_ENABLED).
+func WithCgo(enabled bool) Option {
+	return func(cfg *Config) {
+		cfg.cgo = &enabled
+	}
+}
+
+// WithGOOS sets the target operating system (GOOS).
+func WithGOOS(goos string) Option {
+	return func(cfg *Config) {
+		cfg.goos = goos
+	}
+}
+
+// WithGOARCH sets the target architecture (GOARCH).
+func WithGOARCH(goarch string) Option {
+	return func(cfg *Config) {
+		cfg.goarch = goarch
+	}
+}
+
+// WithGOARM sets the target ARM version (GOARM).
+func WithGOARM(goarm string) Option {
+	return func(cfg *Config) {
+		cfg.goarm = goarm
+	}
+}
+
+// WithEnv adds environment variables in the form "KEY=value", on top of the
+// parent environment.
+func WithEnv(env ...string) Option {
+	return func(cfg *Config) {
+		cfg.env = append(cfg.env, env...)
+	}
+}
+
+// WithGoFlags adds flags to GOFLAGS.
+func WithGoFlags(flags ...string) Option {
+	return func(cfg *Config) {
+		cfg.goflags = append(cfg.goflags, flags...)
+	}
+}
+
+// WithModMode sets the module download mode (-mod), one of "readonly",
+// "vendor" or "mod".
+func WithModMode(mode string) Option {
+	return func(cfg *Config) {
+		cfg.modMode = mode
+	}
+}
+
+// WithTestReport runs go test with -json, printing a concise summary instead
+// of the raw output and collecting the results into a TestReport.
+func WithTestReport() Option {
+	return func(cfg *Config) {
+		cfg.testReport = true
+	}
+}
+
+// WithCover builds with coverage instrumentation (-cover). Running such a
+// binary with GOCOVERDIR set, see CoverageEnv, writes its coverage data.
+func WithCover() Option {
+	return func(cfg *Config) {
+		cfg.cover = true
+	}
+}
+
+// WithCoverPkg applies coverage instrumentation to the packages matching the
+// patterns (-coverpkg), rather than just the packages being built.
+func WithCoverPkg(patterns ...string) Option {
+	return func(cfg *Config) {
+		cfg.coverPkg = append(cfg.coverPkg, patterns...)
+	}
+}
+
+// WithCoverage collects coverage for go test or go run into CoverageDir(name),
+// to be merged by NewCoverageCmd. The directory is resolved and cleared before
+// each run, once the cache directory is set up.
+func WithCoverage(name string) Option {
+	return func(cfg *Config) {
+		cfg.coverage = name
+	}
+}
+
+// WithFileTargets expands directory targets into the go files directly inside
+// them, rather than treating targets as package patterns. Test files are only
+// included for go test.
+func WithFileTargets() Option {
+	return func(cfg *Config) {
+		cfg.fileTargets = true
+	}
+}
+
+// WithTemplates expands argument templates such as "{{ .Outputs.version }}"
+// with the outputs of the dependencies of the step running the command, see
+// buildgo.Expand. Without it, arguments are passed as is.
+func WithTemplates() Option {
+	return func(cfg *Config) {
+		cfg.templates = true
+	}
+}
+
+// WithVCS stamps the version control metadata into the string variables
+// version, commit and date of the package pkg, e.g. "main", at link time. As
+// with WithLdflags, the commit becomes part of the command's fingerprint.
+func WithVCS(info vcs.Info, pkg string) Option {
+	return func(cfg *Config) {
+		for _, opt := range []Option{
+			WithLdflagsX(pkg+".version", info.Version),
+			WithLdflagsX(pkg+".commit", info.Commit),
+			WithLdflagsX(pkg+".date", info.Date()),
+		} {
+			opt(cfg)
+		}
+	}
+}
+
+// WithSuccessCodes sets the exit codes which count as success.
+func WithSuccessCodes(codes ...int) Option {
+	return func(cfg *Config) {
+		cfg.success.Codes = append(cfg.success.Codes, codes...)
+	}
+}
+
+// WithFailOnStderr fails the command if it writes anything to stderr.
+func WithFailOnStderr() Option {
+	return func(cfg *Config) {
+		cfg.success.FailOnStderr = true
+	}
+}
+
+// WithOutputMatcher treats the command as succeeded if a line of its output
+// matches re, e.g. "no Go files", and it exited with one of the codes.
+// Without codes, every line of its output must match, so that other failures
+// are still caught. With WithTestReport, the summary of the packages is
+// matched rather than the go test -json events.
+func WithOutputMatcher(re *regexp.Regexp, codes ...int) Option {
+	return func(cfg *Config) {
+		cfg.success.Matcher = re
+		cfg.success.MatchCodes = append(cfg.success.MatchCodes, codes...)
+	}
+}
@@ -0,0 +1,90 @@
+package cmdgo
+
+import (
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		kind  string
+		args  []string
+		opts  []Option
+		valid bool
+	}{
+		{"no options", kindBuild, nil, nil, true},
+		{"typed options", kindBuild, []string{"-v"}, []Option{WithOutput("bin"), WithRace(), WithModMode("readonly")}, true},
+		{"output with run", kindRun, nil, []Option{WithOutput("bin")}, false},
+		{"race without cgo", kindBuild, nil, []Option{WithRace(), WithCgo(false)}, false},
+		{"invalid mod mode", kindBuild, nil, []Option{WithModMode("strict")}, false},
+		{"output in args", kindBuild, []string{"-o", "bin"}, []Option{WithOutput("bin")}, false},
+		{"mod in goflags", kindBuild, nil, []Option{WithModMode("vendor"), WithGoFlags("-mod=mod")}, false},
+		{"conflicting env", kindBuild, nil, []Option{WithGOOS("linux"), WithEnv("GOOS=darwin")}, false},
+		{"matching env", kindBuild, nil, []Option{WithGOOS("linux"), WithEnv("GOOS=linux")}, true},
+		{"success codes", kindTest, nil, []Option{WithSuccessCodes(0, 1)}, true},
+		{"success codes with gofmt", kindFmt, nil, []Option{WithSuccessCodes(0, 1)}, false},
+		{"ldflags with quotes", kindBuild, nil, []Option{WithLdflagsX("main.quote", `it's "quoted"`)}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := Config{}
+			for _, opt := range tc.opts {
+				opt(&cfg)
+			}
+
+			err := cfg.validate(tc.kind, tc.args)
+			test.AssertEqual(t, "Unexpected validation result", tc.valid, err == nil)
+		})
+	}
+}
+
+func TestFlags(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{}
+	for _, opt := range []Option{
+		WithOutput("bin"),
+		WithTags("a", "b"),
+		WithLdflags("-s", "-w"),
+		WithLdflagsX("main.version", "v1.0.0 (dirty)"),
+		WithTrimpath(),
+	} {
+		opt(&cfg)
+	}
+
+	expected := []string{
+		"-o", "bin",
+		"-tags", "a,b",
+		"-ldflags", "-s -w -X 'main.version=v1.0.0 (dirty)'",
+		"-trimpath",
+	}
+	test.AssertEqual(t, "Unexpected flags", expected, cfg.flags())
+}
+
+func TestQuoteFlag(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"main.version=v1.0.0":         "main.version=v1.0.0",
+		"main.version=v1.0.0 (dirty)": "'main.version=v1.0.0 (dirty)'",
+		"main.name=it's":              "main.name=it's",
+		"main.name=it's here":         `"main.name=it's here"`,
+		`'quoted'`:                    `"'quoted'"`,
+		`"quoted"`:                    `'"quoted"'`,
+	}
+	for s, expected := range tests {
+		quoted, err := quoteFlag(s)
+		test.NilErr(t, err)
+		test.AssertEqual(t, "Unexpected quoting of "+s, expected, quoted)
+	}
+
+	_, err := quoteFlag(`main.name=it's "quoted"`)
+	test.Assert(t, "Expected both quotes to be rejected", err != nil)
+}
@@ -0,0 +1,342 @@
+package cmdgo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	buildgo "github.com/Genekkion/build.go/v1"
+	"github.com/Genekkion/build.go/v1/commands/service"
+)
+
+// ServeConfig represents the configuration of a serve command.
+type ServeConfig struct {
+	args               []string
+	env                []string
+	pollInterval       time.Duration
+	minRestartInterval time.Duration
+	stopTimeout        time.Duration
+	serviceOpts        []service.Option
+}
+
+// defaultServeConfig returns the default serve configuration.
+func defaultServeConfig() ServeConfig {
+	return ServeConfig{
+		pollInterval:       500 * time.Millisecond,
+		minRestartInterval: 2 * time.Second,
+		stopTimeout:        5 * time.Second,
+	}
+}
+
+// ServeOption represents a serve option.
+type ServeOption func(*ServeConfig)
+
+// WithServeArgs sets the arguments the binary is started with.
+func WithServeArgs(args ...string) ServeOption {
+	return func(cfg *ServeConfig) {
+		cfg.args = args
+	}
+}
+
+// WithServeEnv adds environment variables in the form "KEY=value" for the
+// binary.
+func WithServeEnv(env ...string) ServeOption {
+	return func(cfg *ServeConfig) {
+		cfg.env = append(cfg.env, env...)
+	}
+}
+
+// WithPollInterval sets how often the sources are checked for changes.
+func WithPollInterval(d time.Duration) ServeOption {
+	return func(cfg *ServeConfig) {
+		cfg.pollInterval = d
+	}
+}
+
+// WithMinRestartInterval sets the minimum time between two restarts.
+func WithMinRestartInterval(d time.Duration) ServeOption {
+	return func(cfg *ServeConfig) {
+		cfg.minRestartInterval = d
+	}
+}
+
+// WithStopTimeout sets how long to wait after SIGTERM before killing the
+// previous process.
+func WithStopTimeout(d time.Duration) ServeOption {
+	return func(cfg *ServeConfig) {
+		cfg.stopTimeout = d
+	}
+}
+
+// WithServiceOptions passes options through to the underlying service, e.g.
+// readiness probes.
+func WithServiceOptions(opts ...service.Option) ServeOption {
+	return func(cfg *ServeConfig) {
+		cfg.serviceOpts = append(cfg.serviceOpts, opts...)
+	}
+}
+
+// ServeCmd rebuilds a binary whenever its Go sources change, and restarts it.
+// If a build fails, or the new binary does not become ready, the last good
+// binary is kept running.
+type ServeCmd struct {
+	cfg   ServeConfig
+	build *GoCmd
+	bin   string
+}
+
+// NewServeCmd creates a new serve command, which runs build and then starts
+// the binary at bin. The sources watched are the Go files, go.mod and go.sum
+// under the build command's working directory.
+func NewServeCmd(build *GoCmd, bin string, opts ...ServeOption) (cmd *ServeCmd, err error) {
+	if build == nil {
+		return nil, errors.New("build command is required")
+	} else if bin == "" {
+		return nil, errors.New("binary path is required")
+	}
+
+	cfg := defaultServeConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if !filepath.IsAbs(bin) && !strings.ContainsRune(bin, filepath.Separator) {
+		bin = "." + string(filepath.Separator) + bin
+	}
+
+	return &ServeCmd{
+		cfg:   cfg,
+		build: build,
+		bin:   bin,
+	}, nil
+}
+
+// Run builds and serves the binary until the context is cancelled.
+func (c *ServeCmd) Run(ctx context.Context) (err error) {
+	var (
+		current     *service.Cmd
+		lastRestart time.Time
+		snap        map[string]time.Time
+	)
+	// A copy left by an earlier run is not known to be good.
+	os.Remove(c.path(c.lastGoodBin()))
+	defer func() {
+		if current != nil {
+			current.Stop()
+		}
+		os.Remove(c.path(c.lastGoodBin()))
+	}()
+
+	ticker := time.NewTicker(c.cfg.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		next, err := c.snapshot()
+		if err != nil {
+			return err
+		}
+
+		if !maps.Equal(snap, next) && time.Since(lastRestart) >= c.cfg.minRestartInterval {
+			if snap != nil {
+				buildgo.Logger.InfoContext(ctx, "Sources changed, rebuilding", "bin", c.bin)
+			}
+			snap = next
+			lastRestart = time.Now()
+
+			current, err = c.restart(ctx, current)
+			if err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// restart rebuilds the binary and replaces the running process with a new one.
+// The running process is returned unchanged if the build fails. As both would
+// usually listen on the same address, the running process is stopped before
+// the new one starts, and the last good binary is started again if the new
+// one does not become ready.
+func (c *ServeCmd) restart(ctx context.Context, current *service.Cmd) (next *service.Cmd, err error) {
+	err = c.build.Run(ctx)
+	if ctx.Err() != nil {
+		return current, nil
+	} else if err != nil {
+		buildgo.Logger.ErrorContext(ctx, "Build failed, keeping previous binary",
+			"bin", c.bin,
+			"error", err,
+		)
+		return current, nil
+	}
+
+	if current != nil {
+		err = current.Stop()
+		if err != nil {
+			return current, err
+		}
+	}
+
+	next, err = c.start(ctx, c.bin)
+	if err == nil {
+		err = copyFile(c.path(c.lastGoodBin()), c.path(c.bin))
+		if err != nil {
+			buildgo.Logger.WarnContext(ctx, "Unable to keep copy of binary",
+				"bin", c.bin,
+				"error", err,
+			)
+		}
+		buildgo.Logger.InfoContext(ctx, "Serving", "bin", c.bin)
+		return next, nil
+	} else if ctx.Err() != nil {
+		return nil, nil
+	}
+
+	_, statErr := os.Stat(c.path(c.lastGoodBin()))
+	if statErr != nil {
+		buildgo.Logger.ErrorContext(ctx, "Unable to start binary",
+			"bin", c.bin,
+			"error", err,
+		)
+		return nil, nil
+	}
+	buildgo.Logger.ErrorContext(ctx, "Unable to start binary, restarting last good binary",
+		"bin", c.bin,
+		"error", err,
+	)
+
+	next, err = c.start(ctx, c.lastGoodBin())
+	if err != nil {
+		buildgo.Logger.ErrorContext(ctx, "Unable to restart last good binary",
+			"bin", c.lastGoodBin(),
+			"error", err,
+		)
+		return nil, nil
+	}
+	buildgo.Logger.InfoContext(ctx, "Serving", "bin", c.lastGoodBin())
+	return next, nil
+}
+
+// start starts the binary and waits for it to become ready.
+func (c *ServeCmd) start(ctx context.Context, bin string) (cmd *service.Cmd, err error) {
+	opts := []service.Option{
+		service.WithCwd(c.build.cwd),
+		service.WithEnv(c.cfg.env...),
+		service.WithStopTimeout(c.cfg.stopTimeout),
+		service.WithOutput(os.Stdout),
+	}
+	opts = append(opts, c.cfg.serviceOpts...)
+
+	cmd, err = service.NewCmd("serve "+filepath.Base(c.bin), append([]string{bin}, c.cfg.args...), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// lastGoodBin returns the path of the copy of the last binary which became
+// ready, next to the binary.
+func (c *ServeCmd) lastGoodBin() string {
+	return c.bin + ".last-good"
+}
+
+// path returns the path of the binary relative to the working directory of
+// the build, which the binary is started in.
+func (c *ServeCmd) path(bin string) string {
+	if filepath.IsAbs(bin) {
+		return bin
+	}
+	return filepath.Join(c.build.cwd, bin)
+}
+
+// copyFile copies the executable at src to dst, replacing it.
+func copyFile(dst string, src string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o755)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		return err
+	}
+	err = out.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// walkDir walks the sources, replaced in tests.
+var walkDir = filepath.WalkDir
+
+// snapshot returns the modification times of the watched sources.
+func (c *ServeCmd) snapshot() (snap map[string]time.Time, err error) {
+	snap = map[string]time.Time{}
+
+	root := c.build.cwd
+	if root == "" {
+		root = "."
+	}
+
+	err = walkDir(root, func(fp string, d fs.DirEntry, err error) error {
+		// Editors saving atomically remove files in the middle of a walk.
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		name := d.Name()
+		if d.IsDir() {
+			if fp != root && (strings.HasPrefix(name, ".") || name == "testdata" || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if (!strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go")) &&
+			name != "go.mod" && name != "go.sum" {
+			return nil
+		}
+
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		snap[fp] = info.ModTime()
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snap, nil
+}
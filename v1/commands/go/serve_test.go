@@ -0,0 +1,222 @@
+package cmdgo
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/test"
+	"github.com/Genekkion/build.go/v1/commands/service"
+)
+
+// serveApp represents a module with a binary to serve, which prints its
+// version once ready.
+type serveApp struct {
+	t   *testing.T
+	dir string
+	log string
+}
+
+// newServeApp creates the module with the given version of the binary.
+func newServeApp(t *testing.T, version string) (app *serveApp) {
+	t.Helper()
+
+	dir := t.TempDir()
+	app = &serveApp{
+		t:   t,
+		dir: dir,
+		log: filepath.Join(t.TempDir(), "serve.log"),
+	}
+	err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module app\n\ngo 1.21\n"), 0o644)
+	test.NilErr(t, err)
+	app.write(version)
+	return app
+}
+
+// write writes the given version of the binary.
+func (a *serveApp) write(version string) {
+	a.t.Helper()
+
+	src := fmt.Sprintf(`package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func main() {
+	fmt.Println("ready %s")
+	time.Sleep(time.Minute)
+}
+`, version)
+	err := os.WriteFile(filepath.Join(a.dir, "main.go"), []byte(src), 0o644)
+	test.NilErr(a.t, err)
+}
+
+// writeSource writes main.go as is.
+func (a *serveApp) writeSource(src string) {
+	a.t.Helper()
+
+	err := os.WriteFile(filepath.Join(a.dir, "main.go"), []byte(src), 0o644)
+	test.NilErr(a.t, err)
+}
+
+// serveCmd creates the serve command for the module.
+func (a *serveApp) serveCmd(opts ...ServeOption) *ServeCmd {
+	a.t.Helper()
+
+	build, err := NewBuildCmd(a.dir, []string{filepath.Join(a.dir, "main.go")}, []string{"-o", "app"})
+	test.NilErr(a.t, err)
+	opts = append([]ServeOption{
+		WithPollInterval(50 * time.Millisecond),
+		WithMinRestartInterval(0),
+		WithStopTimeout(time.Second),
+		WithServiceOptions(
+			service.WithLogPath(a.log),
+			service.WithReadyLog(regexp.MustCompile(`^ready`)),
+			service.WithPollInterval(10*time.Millisecond),
+			service.WithReadyTimeout(10*time.Second),
+		),
+	}, opts...)
+	cmd, err := NewServeCmd(build, "app", opts...)
+	test.NilErr(a.t, err)
+	return cmd
+}
+
+// served returns the output of the process last started.
+func (a *serveApp) served() string {
+	out, _ := os.ReadFile(a.log)
+	return string(out)
+}
+
+func TestServeCmd_Restart(t *testing.T) {
+	t.Parallel()
+
+	app := newServeApp(t, "v1")
+	cmd := app.serveCmd()
+	ctx := context.Background()
+
+	current, err := cmd.restart(ctx, nil)
+	test.NilErr(t, err)
+	test.Assert(t, "Expected the binary to be served", current != nil)
+	t.Cleanup(func() {
+		current.Stop()
+	})
+	test.AssertEqual(t, "served", "ready v1\n", app.served())
+
+	app.writeSource("package main\n\nfunc main() {\n")
+	next, err := cmd.restart(ctx, current)
+	test.NilErr(t, err)
+	test.Assert(t, "Expected the previous process to be kept after a failed build", next == current)
+	test.AssertEqual(t, "served after failed build", "ready v1\n", app.served())
+
+	app.writeSource("package main\n\nimport \"os\"\n\nfunc main() {\n\tos.Exit(1)\n}\n")
+	current, err = cmd.restart(ctx, current)
+	test.NilErr(t, err)
+	test.Assert(t, "Expected the last good binary to be served", current != nil)
+	test.AssertEqual(t, "served after failed start", "ready v1\n", app.served())
+
+	app.write("v2")
+	current, err = cmd.restart(ctx, current)
+	test.NilErr(t, err)
+	test.Assert(t, "Expected the new binary to be served", current != nil)
+	test.AssertEqual(t, "served after rebuild", "ready v2\n", app.served())
+}
+
+func TestServeCmd_Run(t *testing.T) {
+	t.Parallel()
+
+	app := newServeApp(t, "v1")
+	cmd := app.serveCmd()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Run(ctx)
+	}()
+
+	waitFor := func(expected string) {
+		t.Helper()
+
+		deadline := time.Now().Add(30 * time.Second)
+		for app.served() != expected {
+			test.Assert(t, fmt.Sprintf("Timed out waiting for %q, got %q", expected, app.served()),
+				time.Now().Before(deadline))
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	waitFor("ready v1\n")
+
+	// Test files are not watched.
+	err := os.WriteFile(filepath.Join(app.dir, "main_test.go"), []byte("package main\n"), 0o644)
+	test.NilErr(t, err)
+	app.write("v2")
+	waitFor("ready v2\n")
+
+	cancel()
+	test.NilErr(t, <-done)
+	_, err = os.Stat(filepath.Join(app.dir, "app.last-good"))
+	test.Assert(t, "Expected the copy of the binary to be removed", os.IsNotExist(err))
+}
+
+func TestServeCmd_Snapshot(t *testing.T) {
+	t.Parallel()
+
+	app := newServeApp(t, "v1")
+	err := os.MkdirAll(filepath.Join(app.dir, "testdata"), 0o755)
+	test.NilErr(t, err)
+	for _, name := range []string{"main_test.go", "README.md", filepath.Join("testdata", "x.go")} {
+		err = os.WriteFile(filepath.Join(app.dir, name), nil, 0o644)
+		test.NilErr(t, err)
+	}
+
+	snap, err := app.serveCmd().snapshot()
+	test.NilErr(t, err)
+	var names []string
+	for fp := range snap {
+		names = append(names, strings.TrimPrefix(fp, app.dir+string(filepath.Separator)))
+	}
+	test.Assert(t, fmt.Sprintf("Unexpected sources %v", names),
+		len(names) == 2 && snap[filepath.Join(app.dir, "go.mod")] != (time.Time{}) &&
+			snap[filepath.Join(app.dir, "main.go")] != (time.Time{}))
+}
+
+func TestServeCmd_SnapshotRemoved(t *testing.T) {
+	app := newServeApp(t, "v1")
+	err := os.MkdirAll(filepath.Join(app.dir, "gone"), 0o755)
+	test.NilErr(t, err)
+	for _, name := range []string{"a.go", "b.go", filepath.Join("gone", "c.go")} {
+		err = os.WriteFile(filepath.Join(app.dir, name), []byte("package main\n"), 0o644)
+		test.NilErr(t, err)
+	}
+
+	// Remove files and directories as an editor saving atomically would, once
+	// they have been listed but before they are visited.
+	t.Cleanup(func() {
+		walkDir = filepath.WalkDir
+	})
+	walkDir = func(root string, fn fs.WalkDirFunc) error {
+		return filepath.WalkDir(root, func(fp string, d fs.DirEntry, err error) error {
+			if err == nil && (d.Name() == "a.go" || d.Name() == "gone") {
+				test.NilErr(t, os.RemoveAll(fp))
+			}
+			return fn(fp, d, err)
+		})
+	}
+
+	snap, err := app.serveCmd().snapshot()
+	test.NilErr(t, err)
+	var names []string
+	for fp := range snap {
+		names = append(names, strings.TrimPrefix(fp, app.dir+string(filepath.Separator)))
+	}
+	slices.Sort(names)
+	test.AssertEqual(t, "sources", []string{"b.go", "go.mod", "main.go"}, names)
+}
@@ -0,0 +1,314 @@
+package cmdgo
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/junit"
+)
+
+// TestStatus represents the outcome of a test or package.
+type TestStatus string
+
+const (
+	TestPass TestStatus = "pass"
+	TestFail TestStatus = "fail"
+	TestSkip TestStatus = "skip"
+)
+
+// TestResult represents the outcome of a single test.
+type TestResult struct {
+	Package string
+	Name    string
+	Status  TestStatus
+	Elapsed time.Duration
+	// Output is the test's output, kept for failed tests only.
+	Output string
+}
+
+// PackageResult represents the outcome of a package's tests.
+type PackageResult struct {
+	Name    string
+	Status  TestStatus
+	Elapsed time.Duration
+	Tests   []TestResult
+	// Output is the package output not belonging to any test, e.g. build
+	// errors or panics, kept for failed packages only.
+	Output string
+}
+
+// Count returns the number of tests with the given status.
+func (p PackageResult) Count(status TestStatus) (n int) {
+	for _, t := range p.Tests {
+		if t.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// TestReport represents the structured result of a go test run.
+type TestReport struct {
+	Packages []PackageResult
+}
+
+// Count returns the number of tests with the given status across all
+// packages.
+func (r *TestReport) Count(status TestStatus) (n int) {
+	for _, p := range r.Packages {
+		n += p.Count(status)
+	}
+	return n
+}
+
+// Failed returns the tests which failed.
+func (r *TestReport) Failed() (tests []TestResult) {
+	for _, p := range r.Packages {
+		for _, t := range p.Tests {
+			if t.Status == TestFail {
+				tests = append(tests, t)
+			}
+		}
+	}
+	return tests
+}
+
+// WriteJUnit writes the report as JUnit XML, with a test suite per package.
+func (r *TestReport) WriteJUnit(w io.Writer) error {
+	var suites junit.Suites
+	for _, p := range r.Packages {
+		suite := junit.Suite{
+			Name: p.Name,
+			Time: junit.NewSeconds(p.Elapsed),
+		}
+		for _, t := range p.Tests {
+			c := junit.Case{
+				Name:      t.Name,
+				Classname: t.Package,
+				Time:      junit.NewSeconds(t.Elapsed),
+			}
+			switch t.Status {
+			case TestFail:
+				c.Failure = &junit.Message{
+					Message: "Failed",
+					Body:    t.Output,
+				}
+			case TestSkip:
+				c.Skipped = &junit.Message{
+					Message: "Skipped",
+				}
+			}
+			suite.Add(c)
+		}
+
+		if p.Status == TestFail && p.Count(TestFail) == 0 {
+			// Package failed outside of a test, e.g. a build failure.
+			suite.Add(junit.Case{
+				Name:      "[package]",
+				Classname: p.Name,
+				Error: &junit.Message{
+					Message: "Package failed",
+					Body:    p.Output,
+				},
+			})
+		}
+
+		suites.Add(suite)
+	}
+
+	return junit.Write(w, suites)
+}
+
+// testEvent is an event of go test -json, see go doc test2json.
+type testEvent struct {
+	Time        time.Time
+	Action      string
+	Package     string
+	ImportPath  string
+	Test        string
+	Elapsed     float64
+	Output      string
+	FailedBuild string
+}
+
+// testParser builds a TestReport from a stream of test events.
+type testParser struct {
+	report  *TestReport
+	live    io.Writer
+	pkgs    map[string]*PackageResult
+	output  map[[2]string]*strings.Builder
+	started []string
+}
+
+// parseTestEvents reads go test -json events from r into report, writing a
+// concise summary to live as packages finish. Lines which are not events are
+// passed through to live.
+func parseTestEvents(r io.Reader, live io.Writer, report *TestReport) (err error) {
+	p := testParser{
+		report: report,
+		live:   live,
+		pkgs:   map[string]*PackageResult{},
+		output: map[[2]string]*strings.Builder{},
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := sc.Bytes()
+
+		var ev testEvent
+		if len(line) == 0 || line[0] != '{' || json.Unmarshal(line, &ev) != nil {
+			fmt.Fprintf(live, "%s\n", line)
+			continue
+		}
+		p.handle(ev)
+	}
+
+	// Packages which never finished, e.g. because the run was interrupted.
+	for _, name := range p.started {
+		pkg := p.pkgs[name]
+		if pkg.Status == "" {
+			pkg.Status = TestFail
+			p.finish(pkg)
+		}
+	}
+
+	return sc.Err()
+}
+
+// pkg returns the result of the package, creating it if needed.
+func (p *testParser) pkg(name string) *PackageResult {
+	pkg, ok := p.pkgs[name]
+	if !ok {
+		pkg = &PackageResult{
+			Name: name,
+		}
+		p.pkgs[name] = pkg
+		p.started = append(p.started, name)
+	}
+	return pkg
+}
+
+// buf returns the output buffer of the test, or of the package if test is
+// empty.
+func (p *testParser) buf(pkg string, test string) *strings.Builder {
+	key := [2]string{pkg, test}
+	b, ok := p.output[key]
+	if !ok {
+		b = &strings.Builder{}
+		p.output[key] = b
+	}
+	return b
+}
+
+// handle handles a single event.
+func (p *testParser) handle(ev testEvent) {
+	switch ev.Action {
+	case "build-output":
+		p.buf(ev.ImportPath, "").WriteString(ev.Output)
+		return
+	case "build-fail":
+		return
+	}
+
+	if ev.Package == "" {
+		return
+	}
+	pkg := p.pkg(ev.Package)
+	elapsed := time.Duration(ev.Elapsed * float64(time.Second))
+
+	switch ev.Action {
+	case "output":
+		p.buf(ev.Package, ev.Test).WriteString(ev.Output)
+
+	case "pass", "fail", "skip":
+		status := TestStatus(ev.Action)
+		if ev.Test == "" {
+			pkg.Status = status
+			pkg.Elapsed = elapsed
+			if ev.FailedBuild != "" {
+				p.buf(ev.Package, "").WriteString(p.buf(ev.FailedBuild, "").String())
+			}
+			p.finish(pkg)
+			return
+		}
+
+		t := TestResult{
+			Package: ev.Package,
+			Name:    ev.Test,
+			Status:  status,
+			Elapsed: elapsed,
+		}
+		if status == TestFail {
+			t.Output = p.buf(ev.Package, ev.Test).String()
+		}
+		delete(p.output, [2]string{ev.Package, ev.Test})
+		pkg.Tests = append(pkg.Tests, t)
+	}
+}
+
+// finish adds the package to the report and prints its summary.
+func (p *testParser) finish(pkg *PackageResult) {
+	out := p.buf(pkg.Name, "").String()
+	delete(p.output, [2]string{pkg.Name, ""})
+	if pkg.Status == TestFail {
+		pkg.Output = out
+	}
+
+	p.report.Packages = append(p.report.Packages, *pkg)
+
+	var counts []string
+	for _, status := range []TestStatus{TestFail, TestPass, TestSkip} {
+		n := pkg.Count(status)
+		if n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, map[TestStatus]string{
+				TestFail: "failed",
+				TestPass: "passed",
+				TestSkip: "skipped",
+			}[status]))
+		}
+	}
+	if len(counts) == 0 {
+		counts = append(counts, "no tests")
+	}
+
+	label := map[TestStatus]string{
+		TestPass: "ok  ",
+		TestFail: "FAIL",
+		TestSkip: "skip",
+	}[pkg.Status]
+	fmt.Fprintf(p.live, "%s %s %.3fs (%s)\n", label, pkg.Name, pkg.Elapsed.Seconds(), strings.Join(counts, ", "))
+
+	if pkg.Status != TestFail {
+		return
+	}
+	for _, t := range pkg.Tests {
+		if t.Status == TestFail && !slices.ContainsFunc(pkg.Tests, func(sub TestResult) bool {
+			return sub.Status == TestFail && strings.HasPrefix(sub.Name, t.Name+"/")
+		}) {
+			fmt.Fprintf(p.live, "%s", indent(t.Output))
+		}
+	}
+	if pkg.Count(TestFail) == 0 && out != "" {
+		fmt.Fprintf(p.live, "%s", indent(out))
+	}
+}
+
+// indent indents every line of s.
+func indent(s string) string {
+	if s == "" {
+		return ""
+	}
+	lines := strings.SplitAfter(s, "\n")
+	for i, l := range lines {
+		if l != "" {
+			lines[i] = "    " + l
+		}
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,48 @@
+package cmdgo
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestParseTestEvents(t *testing.T) {
+	t.Parallel()
+
+	f, err := os.Open("testdata/test_events.json")
+	test.NilErr(t, err)
+	defer f.Close()
+
+	var (
+		live   strings.Builder
+		report TestReport
+	)
+	err = parseTestEvents(f, &live, &report)
+	test.NilErr(t, err)
+
+	test.AssertEqual(t, "Unexpected passed count", 7, report.Count(TestPass))
+	test.AssertEqual(t, "Unexpected skipped count", 1, report.Count(TestSkip))
+
+	failed := report.Failed()
+	test.AssertEqual(t, "Unexpected failed count", 2, len(failed))
+	test.AssertEqual(t, "Unexpected failed test", "TestFail/sub", failed[0].Name)
+	test.Assert(t, "Expected output of failed test", strings.Contains(failed[0].Output, "boom"))
+
+	var buildFailed PackageResult
+	for _, p := range report.Packages {
+		if p.Name == "example.com/bf" {
+			buildFailed = p
+		}
+	}
+	test.AssertEqual(t, "Unexpected build failure status", TestFail, buildFailed.Status)
+	test.Assert(t, "Expected build output", strings.Contains(buildFailed.Output, "undefined: undefined"))
+
+	test.Assert(t, "Expected failure summary", strings.Contains(live.String(), "FAIL example.com/ft"))
+
+	var junit strings.Builder
+	err = report.WriteJUnit(&junit)
+	test.NilErr(t, err)
+	test.Assert(t, "Expected package error case", strings.Contains(junit.String(), `<error message="Package failed">`))
+}
@@ -31,7 +31,7 @@ func (c Cmd) Run(ctx context.Context) error {
 	for _, f := range c.funcs {
 		err := f(ctx)
 		if err != nil {
-			buildgo.Logger.Error("Command failed",
+			buildgo.Logger.ErrorContext(ctx, "Command failed",
 				"error", err,
 			)
 			return err
@@ -39,3 +39,15 @@ func (c Cmd) Run(ctx context.Context) error {
 	}
 	return nil
 }
+
+// Output returns a function which sets the named output of the step to the
+// value returned by f, for steps depending on it to read with buildgo.Output.
+func Output[T any](name string, f func(ctx context.Context) (T, error)) CmdFunc {
+	return func(ctx context.Context) error {
+		value, err := f(ctx)
+		if err != nil {
+			return err
+		}
+		return buildgo.SetOutput(ctx, name, value)
+	}
+}
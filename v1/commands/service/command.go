@@ -0,0 +1,286 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	buildgo "github.com/Genekkion/build.go/v1"
+)
+
+// Cmd represents a long-running background service. Running it starts the
+// process and blocks until it is ready; the process keeps running until Stop
+// is called, a dependent step fails while no other running step depends on
+// it, or the build is cleaned up.
+type Cmd struct {
+	cfg  Config
+	name string
+	cmd  string
+	args []string
+
+	mu      sync.Mutex
+	proc    *exec.Cmd
+	exited  chan struct{}
+	exitErr error
+	log     *lineWatcher
+	// cleanup registers Stop to be called on buildgo.Cleanup, once however
+	// many times the service is started.
+	cleanup sync.Once
+}
+
+// NewCmd creates a new service command. The name is used to identify the
+// service in logs and for its log file.
+func NewCmd(name string, args []string, opts ...Option) (cmd *Cmd, err error) {
+	if name == "" {
+		return nil, errors.New("name is required")
+	} else if len(args) == 0 {
+		return nil, errors.New("at least 1 argument is required")
+	}
+
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &Cmd{
+		cfg:  cfg,
+		name: name,
+		cmd:  args[0],
+		args: args[1:],
+	}, nil
+}
+
+// LogPath returns the path of the file the service's output is written to.
+func (c *Cmd) LogPath() string {
+	if c.cfg.logPath != "" {
+		return c.cfg.logPath
+	}
+
+	name := regexp.MustCompile(`[^A-Za-z0-9._-]+`).ReplaceAllString(c.name, "_")
+	return filepath.Join(buildgo.CacheDir, "services", name+".log")
+}
+
+// Run starts the service and waits for it to become ready. Running a service
+// which is already running is a no-op, while one which has exited or been
+// stopped is started again.
+func (c *Cmd) Run(ctx context.Context) (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.proc != nil {
+		select {
+		case <-c.exited:
+			buildgo.Logger.WarnContext(ctx, "Service exited, restarting",
+				"service", c.name,
+				"error", c.exitErr,
+			)
+			c.proc = nil
+		default:
+			return nil
+		}
+	}
+
+	logPath := c.LogPath()
+	err = os.MkdirAll(filepath.Dir(logPath), 0o755)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(logPath)
+	if err != nil {
+		return err
+	}
+
+	buildgo.Logger.DebugContext(ctx, "Starting service",
+		"service", c.name,
+		"cwd", c.cfg.cwd,
+		"cmd", c.cmd,
+		"args", c.args,
+		"log", logPath,
+	)
+
+	c.log = &lineWatcher{
+		w:  f,
+		re: c.cfg.readyLog,
+	}
+	if c.cfg.output != nil {
+		c.log.w = io.MultiWriter(f, c.cfg.output)
+	}
+
+	proc := exec.Command(c.cmd, c.args...)
+	proc.Dir = c.cfg.cwd
+	proc.Stdout = c.log
+	proc.Stderr = c.log
+	proc.Env = slices.Concat(os.Environ(), c.cfg.env, buildgo.Environ(ctx))
+
+	err = proc.Start()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	exited := make(chan struct{})
+	c.proc = proc
+	c.exited = exited
+	go func() {
+		c.exitErr = proc.Wait()
+		f.Close()
+		close(exited)
+	}()
+	c.cleanup.Do(func() {
+		buildgo.RegisterCleanup(func() {
+			err := c.Stop()
+			if err != nil {
+				buildgo.Logger.WarnContext(ctx, "Unable to stop service",
+					"service", c.name,
+					"error", err,
+				)
+			}
+		})
+	})
+
+	err = c.waitReady(ctx)
+	if err != nil {
+		c.stop()
+		return fmt.Errorf("service %q not ready, see %s: %w", c.name, logPath, err)
+	}
+
+	buildgo.Logger.InfoContext(ctx, "Service ready",
+		"service", c.name,
+		"pid", proc.Process.Pid,
+		"log", logPath,
+	)
+
+	return nil
+}
+
+// waitReady polls the readiness probes until all of them pass.
+func (c *Cmd) waitReady(ctx context.Context) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.readyTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(c.cfg.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		err = c.probe(ctx)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-c.exited:
+			return fmt.Errorf("service exited before becoming ready: %v", c.exitErr)
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %v", ctx.Err(), err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe runs each readiness check once.
+func (c *Cmd) probe(ctx context.Context) (err error) {
+	if c.cfg.readyLog != nil && !c.log.matched.Load() {
+		return fmt.Errorf("no output matching %q yet", c.cfg.readyLog)
+	}
+
+	for _, p := range c.cfg.probes {
+		err = p(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stop stops the service, sending SIGTERM first and killing it if it has not
+// exited within the stop timeout.
+func (c *Cmd) Stop() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stop()
+}
+
+// stop is Stop without locking. The service can be started again afterwards.
+func (c *Cmd) stop() error {
+	if c.proc == nil {
+		return nil
+	}
+
+	select {
+	case <-c.exited:
+		c.proc = nil
+		return nil
+	default:
+	}
+
+	buildgo.Logger.Debug("Stopping service", "service", c.name)
+
+	err := c.proc.Process.Signal(syscall.SIGTERM)
+	if err == nil {
+		select {
+		case <-c.exited:
+			c.proc = nil
+			return nil
+		case <-time.After(c.cfg.stopTimeout):
+			buildgo.Logger.Warn("Service did not stop in time, killing",
+				"service", c.name,
+			)
+		}
+	}
+
+	err = c.proc.Process.Kill()
+	if err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	<-c.exited
+	c.proc = nil
+
+	return nil
+}
+
+// lineWatcher writes output through to w, reporting whether any complete line
+// matches re.
+type lineWatcher struct {
+	w       io.Writer
+	re      *regexp.Regexp
+	buf     []byte
+	matched atomic.Bool
+}
+
+// Write implements io.Writer.
+func (l *lineWatcher) Write(p []byte) (n int, err error) {
+	n, err = l.w.Write(p)
+	if l.re == nil || l.matched.Load() {
+		return n, err
+	}
+
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		if l.re.Match(l.buf[:i]) {
+			l.matched.Store(true)
+			l.buf = nil
+			break
+		}
+		l.buf = l.buf[i+1:]
+	}
+
+	return n, err
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+// newTestCmd creates a service running the shell script, ready once it prints
+// "ready".
+func newTestCmd(t *testing.T, script string, opts ...Option) *Cmd {
+	t.Helper()
+
+	opts = append([]Option{
+		WithLogPath(filepath.Join(t.TempDir(), "service.log")),
+		WithReadyLog(regexp.MustCompile(`^ready$`)),
+		WithPollInterval(10 * time.Millisecond),
+		WithReadyTimeout(5 * time.Second),
+		WithStopTimeout(time.Second),
+	}, opts...)
+	cmd, err := NewCmd("test", []string{"sh", "-c", script}, opts...)
+	test.NilErr(t, err)
+	t.Cleanup(func() {
+		cmd.Stop()
+	})
+	return cmd
+}
+
+// pid returns the pid of the running service, or 0 if there is none.
+func (c *Cmd) pid() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.proc == nil {
+		return 0
+	}
+	return c.proc.Process.Pid
+}
+
+func TestCmd(t *testing.T) {
+	t.Parallel()
+
+	cmd := newTestCmd(t, "echo starting; echo ready; exec sleep 60")
+	err := cmd.Run(context.Background())
+	test.NilErr(t, err)
+	pid := cmd.pid()
+	test.Assert(t, "Expected the service to be running", pid != 0)
+
+	err = cmd.Run(context.Background())
+	test.NilErr(t, err)
+	test.AssertEqual(t, "pid after running again", pid, cmd.pid())
+
+	err = cmd.Stop()
+	test.NilErr(t, err)
+	test.AssertEqual(t, "pid after stopping", 0, cmd.pid())
+	err = cmd.Stop()
+	test.NilErr(t, err)
+
+	out, err := os.ReadFile(cmd.LogPath())
+	test.NilErr(t, err)
+	test.AssertEqual(t, "log", "starting\nready\n", string(out))
+}
+
+func TestCmd_NotReady(t *testing.T) {
+	t.Parallel()
+
+	cmd := newTestCmd(t, "echo failing; exit 3")
+	err := cmd.Run(context.Background())
+	test.Assert(t, "Expected the service to not become ready",
+		err != nil && strings.Contains(err.Error(), "exited before becoming ready"))
+	test.AssertEqual(t, "pid", 0, cmd.pid())
+
+	err = cmd.Run(context.Background())
+	test.Assert(t, "Expected running again to start the service again", err != nil)
+
+	cmd = newTestCmd(t, "exec sleep 60", WithReadyTimeout(100*time.Millisecond))
+	err = cmd.Run(context.Background())
+	test.Assert(t, "Expected the service to time out",
+		err != nil && strings.Contains(err.Error(), "deadline exceeded"))
+	test.AssertEqual(t, "pid after timing out", 0, cmd.pid())
+}
+
+func TestCmd_Crash(t *testing.T) {
+	t.Parallel()
+
+	cmd := newTestCmd(t, "echo ready; exec sleep 60")
+	err := cmd.Run(context.Background())
+	test.NilErr(t, err)
+	pid := cmd.pid()
+
+	cmd.mu.Lock()
+	err = cmd.proc.Process.Kill()
+	exited := cmd.exited
+	cmd.mu.Unlock()
+	test.NilErr(t, err)
+	<-exited
+
+	err = cmd.Run(context.Background())
+	test.NilErr(t, err)
+	test.Assert(t, "Expected the service to be started again", cmd.pid() != 0 && cmd.pid() != pid)
+}
+
+func TestCmd_Stop(t *testing.T) {
+	t.Parallel()
+
+	cmd := newTestCmd(t, "trap 'echo terminated; exit 0' TERM; echo ready; while :; do sleep 0.01; done")
+	err := cmd.Run(context.Background())
+	test.NilErr(t, err)
+	err = cmd.Stop()
+	test.NilErr(t, err)
+	out, err := os.ReadFile(cmd.LogPath())
+	test.NilErr(t, err)
+	test.AssertEqual(t, "log after SIGTERM", "ready\nterminated\n", string(out))
+
+	cmd = newTestCmd(t, "trap '' TERM; echo ready; while :; do sleep 0.01; done",
+		WithStopTimeout(200*time.Millisecond))
+	err = cmd.Run(context.Background())
+	test.NilErr(t, err)
+	start := time.Now()
+	err = cmd.Stop()
+	test.NilErr(t, err)
+	test.Assert(t, "Expected the service to be killed after the stop timeout",
+		time.Since(start) >= 200*time.Millisecond)
+	test.AssertEqual(t, "pid after killing", 0, cmd.pid())
+}
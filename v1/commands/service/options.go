@@ -0,0 +1,110 @@
+package service
+
+import (
+	"io"
+	"regexp"
+	"time"
+)
+
+// Config represents the configuration.
+type Config struct {
+	cwd          string
+	env          []string
+	probes       []Probe
+	readyLog     *regexp.Regexp
+	pollInterval time.Duration
+	readyTimeout time.Duration
+	stopTimeout  time.Duration
+	logPath      string
+	output       io.Writer
+}
+
+// defaultConfig returns the default configuration.
+func defaultConfig() Config {
+	return Config{
+		cwd:          ".",
+		pollInterval: 100 * time.Millisecond,
+		readyTimeout: 30 * time.Second,
+		stopTimeout:  5 * time.Second,
+	}
+}
+
+// Option represents an option.
+type Option func(*Config)
+
+// WithCwd sets the working directory.
+func WithCwd(cwd string) Option {
+	return func(cfg *Config) {
+		cfg.cwd = cwd
+	}
+}
+
+// WithEnv adds environment variables in the form "KEY=value", on top of the
+// parent environment.
+func WithEnv(env ...string) Option {
+	return func(cfg *Config) {
+		cfg.env = append(cfg.env, env...)
+	}
+}
+
+// WithProbe adds a readiness probe. All probes must pass before the service
+// is considered ready.
+func WithProbe(probe Probe) Option {
+	return func(cfg *Config) {
+		cfg.probes = append(cfg.probes, probe)
+	}
+}
+
+// WithReadyTCP waits for the given address to accept TCP connections.
+func WithReadyTCP(addr string) Option {
+	return WithProbe(TCP(addr))
+}
+
+// WithReadyHTTP waits for the given url to respond with 200 OK.
+func WithReadyHTTP(url string) Option {
+	return WithProbe(HTTP(url))
+}
+
+// WithReadyLog waits for a line of the service's output to match the regexp.
+func WithReadyLog(re *regexp.Regexp) Option {
+	return func(cfg *Config) {
+		cfg.readyLog = re
+	}
+}
+
+// WithPollInterval sets how often the readiness probes are polled.
+func WithPollInterval(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.pollInterval = d
+	}
+}
+
+// WithReadyTimeout sets how long to wait for the service to become ready.
+func WithReadyTimeout(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.readyTimeout = d
+	}
+}
+
+// WithStopTimeout sets how long to wait after SIGTERM before killing the
+// service.
+func WithStopTimeout(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.stopTimeout = d
+	}
+}
+
+// WithLogPath sets the file the service's output is written to. Defaults to
+// "<cache dir>/services/<name>.log".
+func WithLogPath(fp string) Option {
+	return func(cfg *Config) {
+		cfg.logPath = fp
+	}
+}
+
+// WithOutput additionally writes the service's output to w, e.g. os.Stdout.
+func WithOutput(w io.Writer) Option {
+	return func(cfg *Config) {
+		cfg.output = w
+	}
+}
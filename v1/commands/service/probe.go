@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Probe checks whether a service is ready. It returns nil once the service is
+// ready, and an error describing why not otherwise.
+type Probe func(ctx context.Context) error
+
+// TCP returns a probe which passes once addr accepts TCP connections.
+func TCP(addr string) Probe {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// HTTP returns a probe which passes once a GET request to url responds with
+// 200 OK.
+func HTTP(url string) Probe {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status: %s", res.Status)
+		}
+		return nil
+	}
+}
@@ -1,10 +1,18 @@
 package shell
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 
+	"github.com/Genekkion/build.go/internal/success"
 	buildgo "github.com/Genekkion/build.go/v1"
 )
 
@@ -15,7 +23,8 @@ type Cmd struct {
 	args []string
 }
 
-// NewCmd creates a new generic command.
+// NewCmd creates a new generic command. The arguments are passed to the
+// program as is, without going through a shell, see Script and Pipe.
 func NewCmd(args []string, opts ...Option) (cmd *Cmd, err error) {
 	if len(args) == 0 {
 		return nil, errors.New("at least 1 argument is required")
@@ -24,6 +33,9 @@ func NewCmd(args []string, opts ...Option) (cmd *Cmd, err error) {
 	for _, opt := range opts {
 		opt(&cfg)
 	}
+	if cfg.capture != "" && cfg.stdoutFile != "" {
+		return nil, errors.New("stdout cannot be both captured and redirected to a file")
+	}
 
 	return &Cmd{
 		cfg:  cfg,
@@ -32,18 +44,197 @@ func NewCmd(args []string, opts ...Option) (cmd *Cmd, err error) {
 	}, nil
 }
 
-// Run runs the command.
-func (c Cmd) Run(ctx context.Context) (err error) {
-	buildgo.Logger.Debug("Running shell command",
+// Script creates a new command which runs the script with a real shell, for
+// when shell features beyond Pipe and the redirect options are needed. The
+// shell can be changed with WithShell.
+func Script(script string, opts ...Option) (cmd *Cmd, err error) {
+	shell := []string{"sh", "-c"}
+	if runtime.GOOS == "windows" {
+		shell = []string{"cmd", "/C"}
+	}
+
+	cmd, err = NewCmd(append(shell, script), opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(cmd.cfg.shell) > 0 {
+		cmd.cmd = cmd.cfg.shell[0]
+		cmd.args = append(slices.Clone(cmd.cfg.shell[1:]), script)
+	}
+	return cmd, nil
+}
+
+// process represents a command prepared for running.
+type process struct {
+	cmd *exec.Cmd
+	// capture holds stdout if it is captured into a step output.
+	capture *bytes.Buffer
+	// files are the redirected files, to be closed once the command exits.
+	files []*os.File
+	// run decides whether the command succeeded.
+	run *success.Run
+}
+
+// close closes the redirected files.
+func (p *process) close() {
+	for _, f := range p.files {
+		f.Close()
+	}
+	p.files = nil
+}
+
+// prepare prepares the command for running, opening any redirected files. The
+// pipe ends of a pipeline, if not nil, take the place of stdin and stdout.
+func (c Cmd) prepare(ctx context.Context, stdin io.Reader, stdout io.Writer) (p *process, err error) {
+	env, explicit, err := c.cfg.environ()
+	if err != nil {
+		return nil, err
+	}
+	args := c.args
+	if c.cfg.templates {
+		args, err = buildgo.ExpandArgs(ctx, c.args)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	buildgo.Logger.DebugContext(ctx, "Running shell command",
 		"cwd", c.cfg.cwd,
 		"cmd", c.cmd,
-		"args", c.args,
+		"args", c.cfg.redactArgs(args, explicit),
+		"env", c.cfg.redact(explicit),
+		"cleanEnv", c.cfg.cleanEnv,
 	)
 
-	cmd := exec.CommandContext(ctx, c.cmd, c.args...)
-	cmd.Dir = c.cfg.cwd
-	cmd.Stdout = c.cfg.stdout
-	cmd.Stderr = c.cfg.stderr
+	p = &process{
+		cmd: exec.CommandContext(ctx, c.cmd, args...),
+	}
+	p.cmd.Dir = c.cfg.cwd
+	p.cmd.Env = append(env, buildgo.Environ(ctx)...)
+	p.cmd.Stdin = c.cfg.stdin
+	p.cmd.Stdout = c.cfg.stdout
+	if p.cmd.Stdout == nil {
+		p.cmd.Stdout = buildgo.Stdout(ctx)
+	}
+	p.cmd.Stderr = c.cfg.stderr
+	if p.cmd.Stderr == nil {
+		p.cmd.Stderr = buildgo.Stderr(ctx)
+	}
+
+	open := func(fp string, flag int) (*os.File, error) {
+		if !filepath.IsAbs(fp) {
+			fp = filepath.Join(c.cfg.cwd, fp)
+		}
+		f, err := os.OpenFile(fp, flag, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		p.files = append(p.files, f)
+		return f, nil
+	}
+
+	switch {
+	case stdin != nil:
+		p.cmd.Stdin = stdin
+	case c.cfg.stdinFile != "":
+		p.cmd.Stdin, err = open(c.cfg.stdinFile, os.O_RDONLY)
+	}
+	if err != nil {
+		p.close()
+		return nil, err
+	}
 
-	return cmd.Run()
+	switch {
+	case stdout != nil:
+		p.cmd.Stdout = stdout
+	case c.cfg.capture != "":
+		p.capture = &bytes.Buffer{}
+		p.cmd.Stdout = p.capture
+	case c.cfg.stdoutFile != "":
+		flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if c.cfg.stdoutAppend {
+			flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		p.cmd.Stdout, err = open(c.cfg.stdoutFile, flag)
+	}
+	if err != nil {
+		p.close()
+		return nil, err
+	}
+
+	p.run = c.cfg.success.Start()
+	if c.cfg.stderrToStdout {
+		p.cmd.Stdout, p.cmd.Stderr = p.run.Combined(p.cmd.Stdout)
+		return p, nil
+	}
+
+	if c.cfg.stderrFile != "" {
+		p.cmd.Stderr, err = open(c.cfg.stderrFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+		if err != nil {
+			p.close()
+			return nil, err
+		}
+	}
+	p.cmd.Stdout = p.run.Stdout(p.cmd.Stdout)
+	p.cmd.Stderr = p.run.Stderr(p.cmd.Stderr)
+
+	return p, nil
+}
+
+// setOutput sets the captured stdout of the process as the step output, if
+// any.
+func (c Cmd) setOutput(ctx context.Context, p *process) (err error) {
+	if p.capture == nil {
+		return nil
+	}
+	out := strings.TrimRight(p.capture.String(), "\r\n")
+	return buildgo.SetOutput(ctx, c.cfg.capture, out)
+}
+
+// Run runs the command.
+func (c Cmd) Run(ctx context.Context) (err error) {
+	p, err := c.prepare(ctx, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer p.close()
+
+	err = p.run.Result(p.cmd.Run())
+	if err != nil {
+		return err
+	}
+	return c.setOutput(ctx, p)
+}
+
+// String returns the command line, with any secret values redacted.
+func (c Cmd) String() string {
+	_, explicit, _ := c.cfg.environ()
+	return strings.Join(c.cfg.redactArgs(append([]string{c.cmd}, c.args...), explicit), " ")
+}
+
+// Fingerprint returns a hash of the command line and effective environment,
+// so that a change in either causes the step to be rebuilt. Variables
+// inherited from the parent process are not included.
+func (c Cmd) Fingerprint() []byte {
+	_, explicit, err := c.cfg.environ()
+	if err != nil {
+		// Rebuilds once the env file is fixed.
+		explicit = []string{err.Error()}
+	}
+	slices.Sort(explicit)
+
+	h := buildgo.Hasher()
+	for _, part := range [][]string{
+		{c.cfg.cwd, c.cmd},
+		c.args,
+		explicit,
+		{c.cfg.stdinFile, c.cfg.stdoutFile, c.cfg.stderrFile},
+	} {
+		for _, s := range part {
+			h.Write([]byte(s))
+			h.Write([]byte{0})
+		}
+		h.Write([]byte{1})
+	}
+	return h.Sum(nil)
 }
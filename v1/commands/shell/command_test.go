@@ -0,0 +1,32 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+	buildgo "github.com/Genekkion/build.go/v1"
+)
+
+func TestTemplates(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	cmd, err := NewCmd([]string{"echo", "{{.State}}"}, WithStdout(&out))
+	test.NilErr(t, err)
+	err = cmd.Run(context.Background())
+	test.NilErr(t, err)
+	test.AssertEqual(t, "output without templates", "{{.State}}\n", out.String())
+
+	version, err := NewCmd([]string{"echo", "v1.2.3"}, WithCaptureOutput("version"))
+	test.NilErr(t, err)
+	out.Reset()
+	release, err := NewCmd([]string{"echo", "app-{{ .Outputs.version }}"}, WithTemplates(), WithStdout(&out))
+	test.NilErr(t, err)
+
+	step := buildgo.NewStep("release", release).DependsOn(buildgo.NewStep("version", version))
+	err = step.Run(context.Background())
+	test.NilErr(t, err)
+	test.AssertEqual(t, "output with templates", "app-v1.2.3\n", out.String())
+}
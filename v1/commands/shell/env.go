@@ -0,0 +1,145 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// redacted replaces secret values in logs.
+const redacted = "[REDACTED]"
+
+// envKey returns the key of a "KEY=value" pair.
+func envKey(kv string) string {
+	k, _, _ := strings.Cut(kv, "=")
+	return k
+}
+
+// environ returns the command's effective environment. Explicit variables are
+// those set by the options rather than inherited from the parent process.
+func (cfg Config) environ() (env []string, explicit []string, err error) {
+	for _, fp := range cfg.envFiles {
+		vars, err := parseEnvFile(fp)
+		if err != nil {
+			return nil, nil, err
+		}
+		explicit = append(explicit, vars...)
+	}
+	explicit = append(explicit, cfg.env...)
+
+	var inherited []string
+	if !cfg.cleanEnv {
+		inherited = os.Environ()
+	} else {
+		for _, key := range cfg.allowEnv {
+			v, ok := os.LookupEnv(key)
+			if ok {
+				explicit = append([]string{key + "=" + v}, explicit...)
+			}
+		}
+	}
+
+	explicit = dedupeEnv(explicit)
+	return dedupeEnv(append(inherited, explicit...)), explicit, nil
+}
+
+// redact returns the variables with the values of secrets replaced.
+func (cfg Config) redact(env []string) []string {
+	out := make([]string, len(env))
+	for i, kv := range env {
+		if slices.Contains(cfg.secrets, envKey(kv)) {
+			kv = envKey(kv) + "=" + redacted
+		}
+		out[i] = kv
+	}
+	return out
+}
+
+// redactArgs returns the arguments with any secret values replaced.
+func (cfg Config) redactArgs(args []string, env []string) []string {
+	var values []string
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		if v != "" && slices.Contains(cfg.secrets, k) {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return args
+	}
+
+	out := make([]string, len(args))
+	for i, arg := range args {
+		for _, v := range values {
+			arg = strings.ReplaceAll(arg, v, redacted)
+		}
+		out[i] = arg
+	}
+	return out
+}
+
+// dedupeEnv removes variables which are set again later on, keeping the order
+// of the remaining ones.
+func dedupeEnv(env []string) []string {
+	last := map[string]int{}
+	for i, kv := range env {
+		last[envKey(kv)] = i
+	}
+
+	out := make([]string, 0, len(last))
+	for i, kv := range env {
+		if last[envKey(kv)] == i {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
+
+// parseEnvFile parses a file of "KEY=value" lines. Blank lines, comments
+// starting with "#" and an "export " prefix are allowed, and values may be
+// single or double quoted.
+func parseEnvFile(fp string) (env []string, err error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		k, v, ok := strings.Cut(line, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" || strings.ContainsAny(k, " \t") {
+			return nil, fmt.Errorf("%s:%d: invalid line", fp, n)
+		}
+
+		v = strings.TrimSpace(v)
+		switch {
+		case len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"':
+			v, err = strconv.Unquote(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", fp, n, err)
+			}
+		case len(v) >= 2 && v[0] == '\'' && v[len(v)-1] == '\'':
+			v = v[1 : len(v)-1]
+		default:
+			// Strip trailing comments from unquoted values.
+			if i := strings.Index(v, " #"); i >= 0 {
+				v = strings.TrimSpace(v[:i])
+			}
+		}
+
+		env = append(env, k+"="+v)
+	}
+
+	return env, sc.Err()
+}
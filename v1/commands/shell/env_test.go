@@ -0,0 +1,71 @@
+package shell
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	t.Parallel()
+
+	fp := filepath.Join(t.TempDir(), ".env")
+	err := os.WriteFile(fp, []byte(`# comment
+A=1
+export B = two # trailing
+C="line\nbreak"
+D='$NOT_EXPANDED'
+
+E=
+`), 0o644)
+	test.NilErr(t, err)
+
+	env, err := parseEnvFile(fp)
+	test.NilErr(t, err)
+	test.AssertEqual(t, "env", []string{
+		"A=1",
+		"B=two",
+		"C=line\nbreak",
+		"D=$NOT_EXPANDED",
+		"E=",
+	}, env)
+
+	err = os.WriteFile(fp, []byte("not a variable\n"), 0o644)
+	test.NilErr(t, err)
+	_, err = parseEnvFile(fp)
+	test.Assert(t, "invalid line", err != nil)
+}
+
+func TestEnviron(t *testing.T) {
+	t.Parallel()
+
+	fp := filepath.Join(t.TempDir(), ".env")
+	err := os.WriteFile(fp, []byte("A=file\nTOKEN=hunter2\n"), 0o644)
+	test.NilErr(t, err)
+
+	cfg := defaultConfig()
+	for _, opt := range []Option{
+		WithCleanEnv("PATH"),
+		WithEnvFile(fp),
+		WithEnv("A=explicit", "B=2"),
+		WithRedactEnv("TOKEN"),
+	} {
+		opt(&cfg)
+	}
+
+	env, explicit, err := cfg.environ()
+	test.NilErr(t, err)
+	test.AssertEqual(t, "env", []string{
+		"PATH=" + os.Getenv("PATH"),
+		"TOKEN=hunter2",
+		"A=explicit",
+		"B=2",
+	}, env)
+	test.AssertEqual(t, "explicit", env, explicit)
+
+	test.AssertEqual(t, "redacted", []string{"TOKEN=[REDACTED]"}, cfg.redact([]string{"TOKEN=hunter2"}))
+	test.AssertEqual(t, "redacted args", []string{"--token=[REDACTED]"},
+		cfg.redactArgs([]string{"--token=hunter2"}, explicit))
+}
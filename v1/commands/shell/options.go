@@ -2,22 +2,41 @@ package shell
 
 import (
 	"io"
-	"os"
+	"regexp"
+
+	"github.com/Genekkion/build.go/internal/success"
 )
 
 // Config represents the configuration.
 type Config struct {
-	cwd    string
-	stdout io.Writer
-	stderr io.Writer
+	cwd      string
+	stdout   io.Writer
+	stderr   io.Writer
+	stdin    io.Reader
+	env      []string
+	envFiles []string
+	cleanEnv bool
+	allowEnv []string
+	secrets  []string
+	capture  string
+	// templates expands argument templates, see WithTemplates.
+	templates bool
+
+	stdinFile      string
+	stdoutFile     string
+	stdoutAppend   bool
+	stderrFile     string
+	stderrToStdout bool
+
+	shell []string
+
+	success success.Policy
 }
 
 // defaultConfig returns the default configuration.
 func defaultConfig() Config {
 	return Config{
-		cwd:    ".",
-		stdout: os.Stdout,
-		stderr: os.Stderr,
+		cwd: ".",
 	}
 }
 
@@ -31,16 +50,167 @@ func WithCwd(cwd string) Option {
 	}
 }
 
-// WithStdout sets the stdout writer.
+// WithStdout sets the stdout writer. Defaults to the step's log, see
+// buildgo.Stdout.
 func WithStdout(stdout io.Writer) Option {
 	return func(cfg *Config) {
 		cfg.stdout = stdout
 	}
 }
 
-// WithStderr sets the stderr writer.
+// WithStderr sets the stderr writer. Defaults to the step's log, see
+// buildgo.Stderr.
 func WithStderr(stderr io.Writer) Option {
 	return func(cfg *Config) {
 		cfg.stderr = stderr
 	}
 }
+
+// WithStdin sets the stdin reader.
+func WithStdin(stdin io.Reader) Option {
+	return func(cfg *Config) {
+		cfg.stdin = stdin
+	}
+}
+
+// WithEnv sets environment variables in the form "KEY=value". They take
+// precedence over the parent environment and env files.
+func WithEnv(env ...string) Option {
+	return func(cfg *Config) {
+		cfg.env = append(cfg.env, env...)
+	}
+}
+
+// WithSecretEnv sets environment variables as with WithEnv, redacting their
+// values from logs.
+func WithSecretEnv(env ...string) Option {
+	return func(cfg *Config) {
+		cfg.env = append(cfg.env, env...)
+		for _, kv := range env {
+			cfg.secrets = append(cfg.secrets, envKey(kv))
+		}
+	}
+}
+
+// WithRedactEnv redacts the values of the given environment variables from
+// logs, e.g. secrets loaded from an env file.
+func WithRedactEnv(keys ...string) Option {
+	return func(cfg *Config) {
+		cfg.secrets = append(cfg.secrets, keys...)
+	}
+}
+
+// WithEnvFile loads environment variables from a file of "KEY=value" lines,
+// such as ".env", each time the command runs. Later files take precedence
+// over earlier ones, and variables set with WithEnv over all of them.
+func WithEnvFile(fp string) Option {
+	return func(cfg *Config) {
+		cfg.envFiles = append(cfg.envFiles, fp)
+	}
+}
+
+// WithCleanEnv runs the command without inheriting the parent environment,
+// for hermetic runs. Only the allowed variables, e.g. "PATH" or "HOME", are
+// passed through.
+func WithCleanEnv(allow ...string) Option {
+	return func(cfg *Config) {
+		cfg.cleanEnv = true
+		cfg.allowEnv = append(cfg.allowEnv, allow...)
+	}
+}
+
+// WithCaptureOutput captures the command's stdout, without the trailing
+// newline, into the named output of the step instead of writing it to the
+// stdout writer. Steps depending on the step can then use it in argument
+// templates such as "{{ .Outputs.version }}", see WithTemplates.
+func WithCaptureOutput(name string) Option {
+	return func(cfg *Config) {
+		cfg.capture = name
+	}
+}
+
+// WithTemplates expands argument templates such as "{{ .Outputs.version }}"
+// with the outputs of the dependencies of the step running the command, see
+// buildgo.Expand. Without it, arguments are passed as is, e.g. the format of
+// "docker inspect --format '{{ .State }}'".
+func WithTemplates() Option {
+	return func(cfg *Config) {
+		cfg.templates = true
+	}
+}
+
+// WithStdinFile reads stdin from a file, like "< in.txt". Relative paths are
+// resolved against the working directory.
+func WithStdinFile(fp string) Option {
+	return func(cfg *Config) {
+		cfg.stdinFile = fp
+	}
+}
+
+// WithStdoutFile writes stdout to a file, truncating it, like "> out.txt".
+// Relative paths are resolved against the working directory.
+func WithStdoutFile(fp string) Option {
+	return func(cfg *Config) {
+		cfg.stdoutFile = fp
+		cfg.stdoutAppend = false
+	}
+}
+
+// WithStdoutAppendFile appends stdout to a file, like ">> out.txt".
+func WithStdoutAppendFile(fp string) Option {
+	return func(cfg *Config) {
+		cfg.stdoutFile = fp
+		cfg.stdoutAppend = true
+	}
+}
+
+// WithStderrFile writes stderr to a file, truncating it, like "2> err.txt".
+func WithStderrFile(fp string) Option {
+	return func(cfg *Config) {
+		cfg.stderrFile = fp
+	}
+}
+
+// WithStderrToStdout sends stderr wherever stdout goes, like "2>&1",
+// including into the next command of a pipeline.
+func WithStderrToStdout() Option {
+	return func(cfg *Config) {
+		cfg.stderrToStdout = true
+	}
+}
+
+// WithShell sets the shell command line used by Script, which is followed by
+// the script itself, e.g. WithShell("bash", "-euo", "pipefail", "-c").
+// Defaults to "sh -c", or "cmd /C" on Windows.
+func WithShell(args ...string) Option {
+	return func(cfg *Config) {
+		cfg.shell = args
+	}
+}
+
+// WithSuccessCodes sets the exit codes which count as success, e.g.
+// WithSuccessCodes(0, 2) for a tool which exits with 2 when there is nothing
+// to do.
+func WithSuccessCodes(codes ...int) Option {
+	return func(cfg *Config) {
+		cfg.success.Codes = append(cfg.success.Codes, codes...)
+	}
+}
+
+// WithFailOnStderr fails the command if it writes anything to stderr.
+func WithFailOnStderr() Option {
+	return func(cfg *Config) {
+		cfg.success.FailOnStderr = true
+	}
+}
+
+// WithOutputMatcher treats the command as succeeded if a line of its stdout or
+// stderr matches re and it exited with one of the codes. Without codes, every
+// line of its output must match, so that other failures are still caught.
+// Commands killed by a signal never succeed.
+func WithOutputMatcher(re *regexp.Regexp, codes ...int) Option {
+	return func(cfg *Config) {
+		cfg.success.Matcher = re
+		cfg.success.MatchCodes = append(cfg.success.MatchCodes, codes...)
+	}
+}
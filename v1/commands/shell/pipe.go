@@ -0,0 +1,146 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	buildgo "github.com/Genekkion/build.go/v1"
+)
+
+// PipeCmd represents a pipeline of commands, with the stdout of each command
+// connected to the stdin of the next.
+type PipeCmd struct {
+	cmds []*Cmd
+}
+
+// Pipe creates a new pipeline of commands, like "a | b | c" without a shell.
+// Only the first command may read stdin from elsewhere, and only the last may
+// redirect or capture stdout. As with pipefail, the pipeline fails if any of
+// its commands fail.
+func Pipe(cmds ...*Cmd) (cmd *PipeCmd, err error) {
+	if len(cmds) < 2 {
+		return nil, errors.New("at least 2 commands are required")
+	}
+
+	for i, c := range cmds {
+		if i > 0 && (c.cfg.stdin != nil || c.cfg.stdinFile != "") {
+			return nil, fmt.Errorf("command %d (%s): only the first command can set stdin", i, c.cmd)
+		}
+		if i < len(cmds)-1 && (c.cfg.capture != "" || c.cfg.stdoutFile != "") {
+			return nil, fmt.Errorf("command %d (%s): only the last command can redirect stdout", i, c.cmd)
+		}
+	}
+
+	return &PipeCmd{
+		cmds: cmds,
+	}, nil
+}
+
+// Run runs the pipeline.
+func (c PipeCmd) Run(ctx context.Context) (err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	procs := make([]*process, 0, len(c.cmds))
+	defer func() {
+		for _, p := range procs {
+			p.close()
+		}
+	}()
+
+	// The read ends of the pipes are closed once the commands have started.
+	// The write ends are closed once their writer has exited, as its output
+	// may be copied through the success policy until then, so that the reader
+	// sees EOF.
+	var readEnds []*os.File
+	closeReadEnds := func() {
+		for _, f := range readEnds {
+			f.Close()
+		}
+		readEnds = nil
+	}
+	defer closeReadEnds()
+
+	var stdin io.Reader
+	for i, cmd := range c.cmds {
+		var (
+			r, w   *os.File
+			stdout io.Writer
+		)
+		if i < len(c.cmds)-1 {
+			r, w, err = os.Pipe()
+			if err != nil {
+				return err
+			}
+			readEnds = append(readEnds, r)
+			stdout = w
+		}
+
+		p, err := cmd.prepare(ctx, stdin, stdout)
+		if err != nil {
+			if w != nil {
+				w.Close()
+			}
+			return err
+		}
+		if w != nil {
+			p.files = append(p.files, w)
+		}
+		procs = append(procs, p)
+		stdin = r
+	}
+
+	started := 0
+	for _, p := range procs {
+		err = p.cmd.Start()
+		if err != nil {
+			break
+		}
+		started++
+	}
+	closeReadEnds()
+	if err != nil {
+		cancel()
+	}
+
+	// Commands are waited for in order, as each one's write end must be
+	// closed for the next one to exit.
+	var errs []error
+	for i, p := range procs[:started] {
+		waitErr := p.run.Result(p.cmd.Wait())
+		p.close()
+		if waitErr != nil {
+			errs = append(errs, fmt.Errorf("command %d (%s): %w", i, c.cmds[i].cmd, waitErr))
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("command %d (%s): %w", started, c.cmds[started].cmd, err)
+	} else if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	last := len(c.cmds) - 1
+	return c.cmds[last].setOutput(ctx, procs[last])
+}
+
+// String returns the command lines of the pipeline.
+func (c PipeCmd) String() string {
+	parts := make([]string, len(c.cmds))
+	for i, cmd := range c.cmds {
+		parts[i] = cmd.String()
+	}
+	return strings.Join(parts, " | ")
+}
+
+// Fingerprint returns the combined fingerprint of the commands.
+func (c PipeCmd) Fingerprint() []byte {
+	h := buildgo.Hasher()
+	for _, cmd := range c.cmds {
+		h.Write(cmd.Fingerprint())
+	}
+	return h.Sum(nil)
+}
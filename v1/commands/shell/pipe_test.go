@@ -0,0 +1,128 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestPipe(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	echo, err := NewCmd([]string{"printf", "b\na\nc\n"})
+	test.NilErr(t, err)
+	sort, err := NewCmd([]string{"sort"})
+	test.NilErr(t, err)
+	head, err := NewCmd([]string{"head", "-n", "2"}, WithStdout(&out))
+	test.NilErr(t, err)
+
+	pipe, err := Pipe(echo, sort, head)
+	test.NilErr(t, err)
+	err = pipe.Run(context.Background())
+	test.NilErr(t, err)
+	test.AssertEqual(t, "output", "a\nb\n", out.String())
+}
+
+func TestPipe_Fail(t *testing.T) {
+	t.Parallel()
+
+	fail, err := NewCmd([]string{"false"})
+	test.NilErr(t, err)
+	cat, err := NewCmd([]string{"cat"}, WithStdout(&bytes.Buffer{}))
+	test.NilErr(t, err)
+
+	pipe, err := Pipe(fail, cat)
+	test.NilErr(t, err)
+	err = pipe.Run(context.Background())
+	test.Assert(t, "Expected the failing command to fail the pipeline",
+		err != nil && strings.Contains(err.Error(), "command 0 (false)"))
+
+	redirected, err := NewCmd([]string{"true"}, WithStdoutFile("out.txt"))
+	test.NilErr(t, err)
+	_, err = Pipe(redirected, cat)
+	test.Assert(t, "Expected stdout redirect in the middle to be rejected", err != nil)
+}
+
+func TestRedirects(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "in.txt"), []byte("hello\n"), 0o644)
+	test.NilErr(t, err)
+
+	cmd, err := Script("cat; echo oops >&2",
+		WithCwd(dir),
+		WithStdinFile("in.txt"),
+		WithStdoutFile("out.txt"),
+		WithStderrToStdout(),
+	)
+	test.NilErr(t, err)
+	err = cmd.Run(context.Background())
+	test.NilErr(t, err)
+
+	cmd, err = NewCmd([]string{"echo", "again"}, WithCwd(dir), WithStdoutAppendFile("out.txt"))
+	test.NilErr(t, err)
+	err = cmd.Run(context.Background())
+	test.NilErr(t, err)
+
+	b, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+	test.NilErr(t, err)
+	test.AssertEqual(t, "output", "hello\noops\nagain\n", string(b))
+}
+
+func TestPipe_SuccessCodes(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	echo, err := NewCmd([]string{"printf", "a\nb\n"})
+	test.NilErr(t, err)
+	// grep exits with 1 when nothing matches.
+	grep, err := NewCmd([]string{"grep", "c"}, WithSuccessCodes(0, 1))
+	test.NilErr(t, err)
+	wc, err := NewCmd([]string{"wc", "-l"}, WithStdout(&out))
+	test.NilErr(t, err)
+
+	pipe, err := Pipe(echo, grep, wc)
+	test.NilErr(t, err)
+	err = pipe.Run(context.Background())
+	test.NilErr(t, err)
+	test.AssertEqual(t, "output", "0", strings.TrimSpace(out.String()))
+
+	warn, err := Script("echo warning >&2", WithStderr(&bytes.Buffer{}), WithFailOnStderr())
+	test.NilErr(t, err)
+	err = warn.Run(context.Background())
+	test.Assert(t, "Expected output on stderr to fail the command", err != nil)
+}
+
+func TestRedirects_StderrToStdout(t *testing.T) {
+	t.Parallel()
+
+	script := "for i in 1 2 3 4 5 6 7 8 9 10; do echo out; echo err >&2; done"
+	var out bytes.Buffer
+	cmd, err := Script(script,
+		WithStdout(&out),
+		WithStderrToStdout(),
+		WithOutputMatcher(regexp.MustCompile("^(out|err)$")),
+	)
+	test.NilErr(t, err)
+	err = cmd.Run(context.Background())
+	test.NilErr(t, err)
+	test.AssertEqual(t, "Unexpected number of lines", 20, strings.Count(out.String(), "\n"))
+
+	cmd, err = Script(script, WithStdout(&bytes.Buffer{}), WithStderrToStdout(), WithFailOnStderr())
+	test.NilErr(t, err)
+	err = cmd.Run(context.Background())
+	test.Assert(t, "Expected output on stderr to fail the command", err != nil)
+
+	cmd, err = Script("echo out", WithStdout(&bytes.Buffer{}), WithStderrToStdout(), WithFailOnStderr())
+	test.NilErr(t, err)
+	err = cmd.Run(context.Background())
+	test.NilErr(t, err)
+}
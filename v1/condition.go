@@ -0,0 +1,80 @@
+package buildgo
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// Condition represents a condition for a step to run, see Step.When.
+type Condition struct {
+	// Name describes the condition, e.g. "os is linux", for the reason the
+	// step was skipped.
+	Name  string
+	Check func() bool
+}
+
+// Predicate creates a condition from a custom check.
+func Predicate(name string, check func() bool) Condition {
+	return Condition{
+		Name:  name,
+		Check: check,
+	}
+}
+
+// OnOS holds when running on any of the operating systems, as in GOOS.
+func OnOS(goos ...string) Condition {
+	return Predicate("os is "+strings.Join(goos, " or "), func() bool {
+		return slices.Contains(goos, runtime.GOOS)
+	})
+}
+
+// OnArch holds when running on any of the architectures, as in GOARCH.
+func OnArch(goarch ...string) Condition {
+	return Predicate("arch is "+strings.Join(goarch, " or "), func() bool {
+		return slices.Contains(goarch, runtime.GOARCH)
+	})
+}
+
+// EnvSet holds when the environment variable is set and not empty.
+func EnvSet(key string) Condition {
+	return Predicate(fmt.Sprintf("$%s is set", key), func() bool {
+		return os.Getenv(key) != ""
+	})
+}
+
+// EnvEquals holds when the environment variable has the value, e.g.
+// EnvEquals("CI", "true").
+func EnvEquals(key string, value string) Condition {
+	return Predicate(fmt.Sprintf("$%s is %q", key, value), func() bool {
+		return os.Getenv(key) == value
+	})
+}
+
+// ToolAvailable holds when the program is on the PATH, e.g.
+// ToolAvailable("protoc").
+func ToolAvailable(name string) Condition {
+	return Predicate(name+" is available", func() bool {
+		_, err := exec.LookPath(name)
+		return err == nil
+	})
+}
+
+// FileExists holds when the file or directory exists.
+func FileExists(fp string) Condition {
+	return Predicate(fp+" exists", func() bool {
+		_, err := os.Stat(fp)
+		return err == nil
+	})
+}
+
+// Not holds when the condition does not, e.g. Not(EnvSet("CI")) for local
+// builds only.
+func Not(c Condition) Condition {
+	return Predicate("not "+c.Name, func() bool {
+		return !c.Check()
+	})
+}
@@ -0,0 +1,68 @@
+package buildgo
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestConditions(t *testing.T) {
+	t.Setenv("BUILDGO_TEST_CI", "true")
+
+	test.Assert(t, "Expected current os", OnOS("plan9", runtime.GOOS).Check())
+	test.Assert(t, "Expected other arch to fail", !OnArch("not-an-arch").Check())
+	test.Assert(t, "Expected env to be set", EnvSet("BUILDGO_TEST_CI").Check())
+	test.Assert(t, "Expected env to equal", EnvEquals("BUILDGO_TEST_CI", "true").Check())
+	test.Assert(t, "Expected missing tool to fail", !ToolAvailable("buildgo-no-such-tool").Check())
+	test.Assert(t, "Expected file to exist", FileExists("condition.go").Check())
+	test.AssertEqual(t, "not", "not $BUILDGO_TEST_CI is set", Not(EnvSet("BUILDGO_TEST_CI")).Name)
+}
+
+func TestWhen(t *testing.T) {
+	t.Parallel()
+
+	never := Predicate("never", func() bool { return false })
+
+	dep := NewStep("dep")
+	skipped := NewStep("skipped").When(never).DependsOn(dep)
+	group := Group("group", skipped)
+	err := group.Run(context.Background())
+	test.NilErr(t, err)
+	test.AssertEqual(t, "status", StatusConditionSkipped, skipped.Result().Status)
+	test.AssertEqual(t, "reason", "condition not met: never", skipped.Result().Reason)
+	test.AssertEqual(t, "dependency", StatusConditionSkipped, dep.Result().Status)
+	test.AssertEqual(t, "dependency reason", "skipped skipped, condition not met: never", dep.Result().Reason)
+	test.AssertEqual(t, "dependent", StatusSucceeded, group.Result().Status)
+
+	required := NewStep("required").When(never).Required()
+	err = Group("blocked", required).Run(context.Background())
+	test.Assert(t, "Expected required step to fail", err != nil)
+	test.AssertEqual(t, "required status", StatusFailed, required.Result().Status)
+}
+
+func TestWhen_Outputs(t *testing.T) {
+	t.Parallel()
+
+	version := NewStep("version", commandFunc(func(ctx context.Context) error {
+		return SetOutput(ctx, "version", "v1.2.3")
+	})).When(Predicate("never", func() bool { return false }))
+
+	var (
+		expanded  string
+		outputErr error
+	)
+	release := NewStep("release", commandFunc(func(ctx context.Context) (err error) {
+		_, outputErr = Output[string](ctx, "version")
+		expanded, err = Expand(ctx, "app-{{ .Outputs.version }}{{ if .Outputs.suffix }}-dev{{ end }}")
+		return err
+	})).DependsOn(version)
+
+	err := release.Run(context.Background())
+	test.NilErr(t, err)
+	test.AssertEqual(t, "status", StatusSucceeded, release.Result().Status)
+	test.AssertEqual(t, "expanded", "app-", expanded)
+	test.Assert(t, "Expected the output to be unavailable", errors.Is(outputErr, ErrOutputUnavailable))
+}
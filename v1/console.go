@@ -0,0 +1,249 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// OutputMode represents how the output of steps' commands is shown on the
+// console. The full output of every step is written to its log file
+// regardless.
+type OutputMode string
+
+const (
+	// OutputStream shows output line by line as it is written, prefixed with
+	// the step name.
+	OutputStream OutputMode = "stream"
+	// OutputGrouped shows all of a step's output at once when it finishes.
+	OutputGrouped OutputMode = "grouped"
+	// OutputErrors shows the output of failed steps only.
+	OutputErrors OutputMode = "errors"
+)
+
+// ParseOutputMode parses an output mode.
+func ParseOutputMode(s string) (mode OutputMode, err error) {
+	mode = OutputMode(s)
+	switch mode {
+	case OutputStream, OutputGrouped, OutputErrors:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid output mode: %q", s)
+	}
+}
+
+var (
+	// ConsoleOutput is how the output of steps is shown on the console.
+	ConsoleOutput = OutputStream
+
+	// BuildID identifies the current build, e.g. in the path of its logs.
+	BuildID = uuid.Must(uuid.NewV7()).String()
+
+	// consoleMu serialises writes to the console, so that lines from steps
+	// running in parallel do not interleave.
+	consoleMu sync.Mutex
+
+	// consoleStdout and consoleStderr are the console, shared by the logger,
+	// the output of steps and the progress display.
+	consoleStdout = consoleWriter{f: os.Stdout}
+	consoleStderr = consoleWriter{f: os.Stderr}
+)
+
+// consoleWriter represents a console stream. Writes are serialised, and the
+// progress display is cleared before and redrawn after each write so that it
+// stays below the output.
+type consoleWriter struct {
+	f *os.File
+}
+
+// Write writes p to the console.
+func (c consoleWriter) Write(p []byte) (n int, err error) {
+	consoleMu.Lock()
+	defer consoleMu.Unlock()
+
+	display.clear()
+	n, err = c.f.Write(p)
+	display.draw()
+	return n, err
+}
+
+// Stat returns the file info of the underlying file, for terminal detection.
+func (c consoleWriter) Stat() (os.FileInfo, error) {
+	return c.f.Stat()
+}
+
+// Stdout returns the writer for the stdout of the command, which is the
+// running step's log if it is run by a step and the console otherwise.
+func Stdout(ctx context.Context) io.Writer {
+	s := StepFromCtx(ctx)
+	if s == nil || s.log == nil {
+		return consoleStdout
+	}
+	return s.log.stdout
+}
+
+// Stderr returns the writer for the stderr of the command, see Stdout.
+func Stderr(ctx context.Context) io.Writer {
+	s := StepFromCtx(ctx)
+	if s == nil || s.log == nil {
+		return consoleStderr
+	}
+	return s.log.stderr
+}
+
+// unsafeFileChars matches the characters replaced in file names.
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// FileName returns the name as a safe file name, e.g. for a step.
+func FileName(name string) string {
+	return unsafeFileChars.ReplaceAllString(name, "_")
+}
+
+// stepLog represents the captured output of a step's run.
+type stepLog struct {
+	name string
+	mode OutputMode
+	path string
+	file *os.File
+
+	// mu guards the file and buffer, which stdout and stderr share.
+	mu sync.Mutex
+	// buf holds the output for the grouped and errors modes.
+	buf bytes.Buffer
+
+	stdout *lineWriter
+	stderr *lineWriter
+}
+
+// newStepLog creates the log of a step's run in the log directory of the
+// build. Output is only shown on the console if the cache directory is not
+// set up.
+func newStepLog(name string) (l *stepLog, err error) {
+	l = &stepLog{
+		name: name,
+		mode: ConsoleOutput,
+	}
+	l.stdout = &lineWriter{log: l, console: consoleStdout}
+	l.stderr = &lineWriter{log: l, console: consoleStderr}
+
+	if CacheDir == "" {
+		return l, nil
+	}
+
+	dir := filepath.Join(CacheDir, "logs", BuildID)
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	l.path = filepath.Join(dir, FileName(name)+".log")
+	l.file, err = os.Create(l.path)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// finish shows any output left for the console according to the mode, and
+// closes the log file.
+func (l *stepLog) finish(failed bool) {
+	l.stdout.flush()
+	l.stderr.flush()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.buf.Len() > 0 {
+		switch {
+		case l.mode == OutputGrouped:
+			l.print(consoleStdout, "==> "+l.name)
+		case l.mode == OutputErrors && failed:
+			l.print(consoleStderr, "==> "+l.name+" (failed)")
+		}
+	}
+
+	if l.file != nil {
+		err := l.file.Close()
+		if err != nil {
+			Logger.Warn("Unable to close step log",
+				"step", l.name,
+				"error", err,
+			)
+		}
+	}
+}
+
+// print writes the buffered output to w under a header, in a single write so
+// that it is not interleaved with other output.
+func (l *stepLog) print(w io.Writer, header string) {
+	var b bytes.Buffer
+	b.WriteString(header + "\n")
+	b.Write(l.buf.Bytes())
+	if !bytes.HasSuffix(l.buf.Bytes(), []byte("\n")) {
+		b.WriteByte('\n')
+	}
+	w.Write(b.Bytes())
+}
+
+// lineWriter represents stdout or stderr of a step, written to the step's log
+// file and shown on the console a line at a time.
+type lineWriter struct {
+	log     *stepLog
+	console io.Writer
+	// partial is the incomplete last line in stream mode.
+	partial []byte
+}
+
+// Write writes p to the log file, and the console or buffer depending on the
+// mode.
+func (w *lineWriter) Write(p []byte) (n int, err error) {
+	l := w.log
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file != nil {
+		_, err = l.file.Write(p)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if l.mode != OutputStream {
+		l.buf.Write(p)
+		return len(p), nil
+	}
+
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.writeLine(w.partial[:i+1])
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush shows the incomplete last line, if any.
+func (w *lineWriter) flush() {
+	w.log.mu.Lock()
+	defer w.log.mu.Unlock()
+
+	if len(w.partial) > 0 {
+		w.writeLine(append(w.partial, '\n'))
+		w.partial = nil
+	}
+}
+
+// writeLine writes a line to the console, prefixed with the step name.
+func (w *lineWriter) writeLine(line []byte) {
+	fmt.Fprintf(w.console, "[%s] %s", w.log.name, line)
+}
@@ -0,0 +1,50 @@
+package buildgo
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestStepLog(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	file, err := os.Create(filepath.Join(dir, "step.log"))
+	test.NilErr(t, err)
+
+	var console bytes.Buffer
+	l := &stepLog{
+		name: "build",
+		mode: OutputStream,
+		file: file,
+	}
+	l.stdout = &lineWriter{log: l, console: &console}
+	l.stderr = &lineWriter{log: l, console: &console}
+
+	l.stdout.Write([]byte("first li"))
+	l.stderr.Write([]byte("warning\n"))
+	l.stdout.Write([]byte("ne\nsecond"))
+	l.finish(false)
+
+	test.AssertEqual(t, "console",
+		"[build] warning\n[build] first line\n[build] second\n", console.String())
+
+	b, err := os.ReadFile(file.Name())
+	test.NilErr(t, err)
+	test.AssertEqual(t, "log", "first liwarning\nne\nsecond", string(b))
+}
+
+func TestParseOutputMode(t *testing.T) {
+	t.Parallel()
+
+	mode, err := ParseOutputMode("grouped")
+	test.NilErr(t, err)
+	test.AssertEqual(t, "mode", OutputGrouped, mode)
+
+	_, err = ParseOutputMode("quiet")
+	test.Assert(t, "Expected invalid mode to fail", err != nil)
+}
@@ -8,24 +8,35 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"sync"
 
 	"github.com/Genekkion/build.go/internal/db"
 	"github.com/Genekkion/build.go/internal/log/slog"
 )
 
 var (
-	Logger = func() *slog2.Logger {
-		return slog.NewLogger(
-			slog.NewHandler(os.Stdout, &slog2.HandlerOptions{
-				Level: slog2.LevelInfo,
-			}),
-		)
-	}()
+	// Logger is pretty on a terminal and JSON otherwise, see the -log-format
+	// flag of Main.
+	Logger   = newLogger(slog.FormatAuto)
 	CacheDir string
 	CacheDb  *sql.DB
 	Hasher   = sha256.New
+
+	// cleanups are functions to be called on Cleanup, in reverse order of
+	// registration.
+	cleanups   []func()
+	cleanupsMu sync.Mutex
 )
 
+// newLogger creates a logger writing to stdout in the given format.
+func newLogger(format slog.Format) *slog2.Logger {
+	return slog.NewLogger(
+		slog.NewFormatHandler(consoleStdout, format, &slog2.HandlerOptions{
+			Level: slog2.LevelInfo,
+		}),
+	)
+}
+
 // Setup sets up the global variables.
 // Warning: will panic if unable to set up successfully.
 func Setup() {
@@ -41,9 +52,29 @@ func Setup() {
 	)
 }
 
-// Cleanup cleans up the global variables.
+// Cleanup cleans up the global variables, running any registered cleanup
+// functions first.
 func Cleanup() {
-	CacheDb.Close()
+	cleanupsMu.Lock()
+	fs := cleanups
+	cleanups = nil
+	cleanupsMu.Unlock()
+
+	for i := len(fs) - 1; i >= 0; i-- {
+		fs[i]()
+	}
+
+	if CacheDb != nil {
+		CacheDb.Close()
+	}
+}
+
+// RegisterCleanup registers a function to be called on Cleanup, e.g. to tear
+// down background processes once the build ends.
+func RegisterCleanup(f func()) {
+	cleanupsMu.Lock()
+	defer cleanupsMu.Unlock()
+	cleanups = append(cleanups, f)
 }
 
 // setupCache sets up the cache directory and database.
@@ -85,6 +116,16 @@ func SetHash(fp string, h []byte) (err error) {
 	return db.SetHash(CacheDb, fp, h)
 }
 
+// GetFingerprint returns the fingerprint for the given step.
+func GetFingerprint(step string) (h []byte, err error) {
+	return db.GetFingerprint(CacheDb, step)
+}
+
+// SetFingerprint sets the fingerprint for the given step.
+func SetFingerprint(step string, h []byte) (err error) {
+	return db.SetFingerprint(CacheDb, step, h)
+}
+
 // hashFile returns the hash of the file contents
 func hashFile(fp string) (h []byte, err error) {
 	hs := Hasher()
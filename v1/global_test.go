@@ -0,0 +1,22 @@
+package buildgo
+
+import (
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestCleanup(t *testing.T) {
+	var order []string
+	RegisterCleanup(func() {
+		order = append(order, "db")
+	})
+	RegisterCleanup(func() {
+		order = append(order, "api")
+	})
+
+	Cleanup()
+	test.AssertEqual(t, "order", []string{"api", "db"}, order)
+	Cleanup()
+	test.AssertEqual(t, "order after cleaning up again", []string{"api", "db"}, order)
+}
@@ -0,0 +1,188 @@
+package buildgo
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/db"
+)
+
+// historyLimit is the number of most recent builds kept in the history.
+const historyLimit = 1000
+
+// recordBuild records the build of the targets and the outcome of their
+// steps in the cache database.
+func recordBuild(start time.Time, targets []*Step, buildErr error) {
+	if CacheDb == nil {
+		return
+	}
+
+	build := db.Build{
+		ID:      BuildID,
+		Start:   start,
+		End:     time.Now(),
+		Outcome: string(StatusSucceeded),
+	}
+	if buildErr != nil {
+		build.Outcome = string(StatusFailed)
+	}
+	for _, s := range targets {
+		build.Roots = append(build.Roots, s.name)
+	}
+
+	var steps []db.BuildStep
+	for _, s := range graph(targets) {
+		res := s.Result()
+		if res.Status == StatusPending {
+			continue
+		}
+		steps = append(steps, db.BuildStep{
+			Name:     s.name,
+			Status:   string(res.Status),
+			Start:    res.Start,
+			Duration: res.Duration,
+			Reason:   res.Reason,
+			Attempts: res.Attempts,
+			ExitCode: exitCode(res.Err),
+		})
+	}
+
+	err := db.AddBuild(CacheDb, build, steps, historyLimit)
+	if err != nil {
+		Logger.Warn("Unable to record build history",
+			"buildId", BuildID,
+			"error", err,
+		)
+	}
+}
+
+// exitCode returns the exit code of the command which caused err, 0 if err is
+// nil and -1 if it was not caused by a command exiting.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// runHistory shows the recent builds, the slowest steps and how their
+// durations are trending.
+func runHistory(args []string) (err error) {
+	fs := flag.NewFlagSet(os.Args[0]+" history", flag.ContinueOnError)
+	nBuilds := fs.Int("builds", 10, "number of recent builds to show and compute step statistics from")
+	nSteps := fs.Int("steps", 10, "number of slowest steps to show")
+	err = fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if CacheDb == nil {
+		return errors.New("cache is not set up, call Setup first")
+	}
+
+	builds, err := db.GetBuilds(CacheDb, *nBuilds)
+	if err != nil {
+		return err
+	}
+	runs, err := db.GetStepRuns(CacheDb, *nBuilds)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(consoleStdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "RECENT BUILDS")
+	fmt.Fprintln(w, "STARTED\tDURATION\tOUTCOME\tSTEPS\tID")
+	for _, b := range builds {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			b.Start.Local().Format(time.DateTime),
+			formatDuration(b.End.Sub(b.Start)),
+			b.Outcome,
+			strings.Join(b.Roots, ", "),
+			b.ID,
+		)
+	}
+
+	stats := stepStats(runs)
+	if len(stats) > *nSteps {
+		stats = stats[:*nSteps]
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "SLOWEST STEPS")
+	fmt.Fprintln(w, "STEP\tRUNS\tAVERAGE\tMAX\tLAST\tTREND\tRECENT")
+	for _, st := range stats {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%+.0f%%\t%s\n",
+			st.name,
+			st.runs,
+			formatDuration(st.average),
+			formatDuration(st.max),
+			formatDuration(st.last),
+			st.trend*100,
+			st.recent,
+		)
+	}
+
+	return w.Flush()
+}
+
+// stepStat represents the statistics of a step's recent runs.
+type stepStat struct {
+	name    string
+	runs    int
+	average time.Duration
+	max     time.Duration
+	last    time.Duration
+	// trend is how much longer the last run took than the average, as a
+	// fraction.
+	trend float64
+	// recent lists the durations of the last few runs, oldest first.
+	recent string
+}
+
+// stepStats returns the statistics of each step's runs, which are ordered
+// newest first, slowest step first.
+func stepStats(runs map[string][]db.BuildStep) (stats []stepStat) {
+	for name, rs := range runs {
+		st := stepStat{
+			name: name,
+			runs: len(rs),
+			last: rs[0].Duration,
+		}
+
+		var total time.Duration
+		for _, r := range rs {
+			total += r.Duration
+			st.max = max(st.max, r.Duration)
+		}
+		st.average = total / time.Duration(len(rs))
+		if st.average > 0 {
+			st.trend = float64(st.last-st.average) / float64(st.average)
+		}
+
+		var recent []string
+		for _, r := range slices.Backward(rs[:min(len(rs), 5)]) {
+			recent = append(recent, formatDuration(r.Duration))
+		}
+		st.recent = strings.Join(recent, " ")
+
+		stats = append(stats, st)
+	}
+
+	slices.SortFunc(stats, func(a, b stepStat) int {
+		if c := cmp.Compare(b.average, a.average); c != 0 {
+			return c
+		}
+		return strings.Compare(a.name, b.name)
+	})
+	return stats
+}
@@ -0,0 +1,135 @@
+package buildgo
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/log/slog"
+	"github.com/Genekkion/build.go/internal/otlp"
+)
+
+const (
+	// otlpScope is the instrumentation scope of exported spans.
+	otlpScope = "github.com/Genekkion/build.go"
+	// otlpTimeout is how long exporting spans may take.
+	otlpTimeout = 10 * time.Second
+)
+
+// otlpEndpoint returns the OTLP/HTTP traces endpoint from the standard
+// environment variables, or "" if none is set. As in the specification, the
+// traces endpoint is used as is, while /v1/traces is added to the base one.
+func otlpEndpoint() string {
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+		return otlp.Endpoint(base)
+	}
+	return ""
+}
+
+// exportSpans exports the spans of the build of the steps, which include all
+// of their dependencies, to an OTLP/HTTP traces endpoint and/or appends them
+// to a file in the OTLP JSON format. The context must be the build's, see
+// withBuild.
+func exportSpans(ctx context.Context, endpoint string, fp string, start time.Time, end time.Time, steps []*Step,
+	buildErr error) (err error) {
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = "build.go"
+	}
+	body, err := otlp.Encode(service, otlpScope, otlpSpans(ctx, start, end, steps, buildErr))
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	if fp != "" {
+		errs = append(errs, otlp.WriteFile(fp, body))
+	}
+	if endpoint != "" {
+		headers, err := otlp.ParseHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+		if err != nil {
+			return err
+		}
+
+		// Spans are still exported if the build was interrupted.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), otlpTimeout)
+		defer cancel()
+		errs = append(errs, otlp.Send(ctx, endpoint, headers, body))
+	}
+	return errors.Join(errs...)
+}
+
+// otlpSpans returns the spans of the build, its steps and their commands.
+// Steps which did not start, e.g. as a dependency failed, have no span.
+func otlpSpans(ctx context.Context, start time.Time, end time.Time, steps []*Step, buildErr error) (spans []otlp.Span) {
+	var traceId string
+	if id, err := slog.TraceIDFromCtx(ctx); err == nil {
+		traceId = hex.EncodeToString(id[:])
+	}
+	buildSpan, _ := slog.SpanFromCtx(ctx)
+
+	spans = append(spans, otlp.Span{
+		TraceID: traceId,
+		SpanID:  buildSpan.String(),
+		Name:    "build",
+		Start:   start,
+		End:     end,
+		Attrs: map[string]any{
+			"buildgo.build.id":    BuildID,
+			"buildgo.duration_ms": end.Sub(start),
+		},
+		Err: buildErr,
+	})
+
+	for _, s := range steps {
+		res := s.Result()
+		if res.SpanID == "" {
+			continue
+		}
+
+		attrs := map[string]any{
+			"buildgo.step.name":      s.name,
+			"buildgo.step.status":    string(res.Status),
+			"buildgo.step.cache_hit": res.Status == StatusSkipped,
+			"buildgo.step.reason":    res.Reason,
+			"buildgo.duration_ms":    res.Duration,
+		}
+		if res.Status != StatusSkipped {
+			attrs["buildgo.step.attempts"] = res.Attempts
+			attrs["buildgo.exit_code"] = exitCode(res.Err)
+		}
+		spans = append(spans, otlp.Span{
+			TraceID:      traceId,
+			SpanID:       res.SpanID,
+			ParentSpanID: buildSpan.String(),
+			Name:         s.name,
+			Start:        res.Start,
+			End:          res.Start.Add(res.Duration),
+			Attrs:        attrs,
+			Err:          res.Err,
+		})
+
+		for _, cmd := range res.Commands {
+			spans = append(spans, otlp.Span{
+				TraceID:      traceId,
+				SpanID:       cmd.SpanID,
+				ParentSpanID: res.SpanID,
+				Name:         cmd.Name,
+				Start:        cmd.Start,
+				End:          cmd.Start.Add(cmd.Duration),
+				Attrs: map[string]any{
+					"buildgo.step.name":   s.name,
+					"buildgo.exit_code":   exitCode(cmd.Err),
+					"buildgo.duration_ms": cmd.Duration,
+				},
+				Err: cmd.Err,
+			})
+		}
+	}
+	return spans
+}
@@ -0,0 +1,52 @@
+package buildgo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/log/slog"
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestOtlpSpans(t *testing.T) {
+	t.Parallel()
+
+	ctx := withBuild(context.Background())
+	buildSpan, _ := slog.SpanFromCtx(ctx)
+	start := time.Now()
+
+	lint := &Step{name: "lint"}
+	lint.setResult(Result{Status: StatusSkipped, SpanID: "00000000000000a1", Start: start})
+	build := (&Step{name: "build"}).DependsOn(lint)
+	build.setResult(Result{
+		Status:   StatusSucceeded,
+		SpanID:   "00000000000000b1",
+		Start:    start,
+		Duration: time.Second,
+		Attempts: 1,
+		Commands: []CommandResult{{Name: "go build", SpanID: "00000000000000b2", Start: start, Duration: time.Second}},
+	})
+	deploy := (&Step{name: "deploy"}).DependsOn(build)
+	deploy.setResult(Result{Status: StatusFailed})
+
+	spans := otlpSpans(ctx, start, start.Add(2*time.Second), []*Step{lint, build, deploy}, nil)
+	test.AssertEqual(t, "spans", 4, len(spans))
+	test.AssertEqual(t, "build span", buildSpan.String(), spans[0].SpanID)
+	test.AssertEqual(t, "cache hit", true, spans[1].Attrs["buildgo.step.cache_hit"])
+	test.AssertEqual(t, "step parent", buildSpan.String(), spans[2].ParentSpanID)
+	test.AssertEqual(t, "command parent", "00000000000000b1", spans[3].ParentSpanID)
+	test.AssertEqual(t, "exit code", 0, spans[3].Attrs["buildgo.exit_code"])
+}
+
+func TestOtlpEndpoint(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	test.AssertEqual(t, "unset", "", otlpEndpoint())
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+	test.AssertEqual(t, "base", "http://collector:4318/v1/traces", otlpEndpoint())
+
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://traces:4318")
+	test.AssertEqual(t, "traces", "http://traces:4318", otlpEndpoint())
+}
@@ -0,0 +1,299 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/Genekkion/build.go/internal/db"
+)
+
+// ctxKey is the type of the keys in the context.
+type ctxKey int
+
+const (
+	// ctxStep is the key for the running step in the context.
+	ctxStep ctxKey = iota
+)
+
+// withStep adds the running step to the context.
+func withStep(ctx context.Context, s *Step) context.Context {
+	return context.WithValue(ctx, ctxStep, s)
+}
+
+// StepFromCtx returns the step running the command, or nil if the command is
+// not run by a step.
+func StepFromCtx(ctx context.Context) *Step {
+	s, _ := ctx.Value(ctxStep).(*Step)
+	return s
+}
+
+// SetOutput sets a named output of the step running the command, which steps
+// depending on it can read with Output or in argument templates. The value is
+// stored as JSON in the cache, so that it is still available when the step is
+// skipped on the next build.
+func SetOutput(ctx context.Context, name string, value any) (err error) {
+	s := StepFromCtx(ctx)
+	if s == nil {
+		return errors.New("output set outside of a step")
+	}
+
+	s.outputsMu.Lock()
+	defer s.outputsMu.Unlock()
+
+	if s.outputs == nil {
+		s.outputs = map[string]any{}
+	}
+	s.outputs[name] = value
+	return nil
+}
+
+// Outputs returns the outputs of the step.
+func (s *Step) Outputs() map[string]any {
+	s.outputsMu.Lock()
+	defer s.outputsMu.Unlock()
+
+	return maps.Clone(s.outputs)
+}
+
+// lookupOutput returns the named output of the nearest dependency of the step
+// which has it. Only dependencies are searched, as they are guaranteed to have
+// run before the step.
+func (s *Step) lookupOutput(name string) (value any, ok bool) {
+	s.walkDeps(func(dep *Step) bool {
+		dep.outputsMu.Lock()
+		defer dep.outputsMu.Unlock()
+
+		value, ok = dep.outputs[name]
+		return !ok
+	})
+	return value, ok
+}
+
+// outputNames returns the names of the outputs of the step's dependencies.
+func (s *Step) outputNames() (names []string) {
+	seen := map[string]bool{}
+	s.walkDeps(func(dep *Step) bool {
+		dep.outputsMu.Lock()
+		defer dep.outputsMu.Unlock()
+
+		for name := range dep.outputs {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		return true
+	})
+	return names
+}
+
+// hashOutputs writes the outputs of the step's dependencies to w, as its
+// commands may read them, returning whether there are any.
+func (s *Step) hashOutputs(w io.Writer) (found bool) {
+	names := s.outputNames()
+	slices.Sort(names)
+	for _, name := range names {
+		value, _ := s.lookupOutput(name)
+		b, err := json.Marshal(value)
+		if err != nil {
+			b = []byte(err.Error())
+		}
+		w.Write([]byte(name))
+		w.Write([]byte{0})
+		w.Write(b)
+		w.Write([]byte{0})
+	}
+	return len(names) > 0
+}
+
+// ErrOutputUnavailable is returned by Output for an output which no dependency
+// set while one of them was skipped by its conditions, see Step.When, so that
+// the command can carry on without it.
+var ErrOutputUnavailable = errors.New("output unavailable as a dependency was skipped by its conditions")
+
+// Output returns the named output of a dependency of the step running the
+// command, converted to T.
+func Output[T any](ctx context.Context, name string) (value T, err error) {
+	s := StepFromCtx(ctx)
+	if s == nil {
+		return value, errors.New("output read outside of a step")
+	}
+
+	raw, ok := s.lookupOutput(name)
+	if !ok && s.hasConditionSkippedDep() {
+		return value, fmt.Errorf("output %q: %w", name, ErrOutputUnavailable)
+	} else if !ok {
+		return value, fmt.Errorf("output %q is not set by any dependency of step %q", name, s.name)
+	}
+
+	switch v := raw.(type) {
+	case T:
+		return v, nil
+	case json.RawMessage:
+		err = json.Unmarshal(v, &value)
+		if err != nil {
+			return value, fmt.Errorf("output %q: %w", name, err)
+		}
+		return value, nil
+	default:
+		return value, fmt.Errorf("output %q is a %T, not a %T", name, raw, value)
+	}
+}
+
+// Expand expands argument templates such as "{{ .Outputs.version }}" in s
+// using the outputs of the dependencies of the step running the command.
+// Strings without templates are returned as is. Commands only expand their
+// arguments when asked to, e.g. with shell.WithTemplates, as other tools use
+// the same syntax. Outputs which are unavailable as a dependency was skipped
+// by its conditions expand to "", see ErrOutputUnavailable.
+func Expand(ctx context.Context, s string) (expanded string, err error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+
+	step := StepFromCtx(ctx)
+	if step == nil {
+		return "", errors.New("template expanded outside of a step")
+	}
+
+	tmpl, err := template.New(step.name).Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", err
+	}
+
+	outputs := map[string]any{}
+	if step.hasConditionSkippedDep() {
+		for _, name := range templateOutputs(tmpl.Tree.Root) {
+			outputs[name] = ""
+		}
+	}
+	for _, name := range step.outputNames() {
+		raw, _ := step.lookupOutput(name)
+		msg, ok := raw.(json.RawMessage)
+		if !ok {
+			outputs[name] = raw
+			continue
+		}
+
+		var value any
+		err = json.Unmarshal(msg, &value)
+		if err != nil {
+			return "", fmt.Errorf("output %q: %w", name, err)
+		}
+		outputs[name] = value
+	}
+
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, struct {
+		Outputs map[string]any
+	}{
+		Outputs: outputs,
+	})
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// templateOutputs returns the names of the outputs used in the template
+// node, as in ".Outputs.name".
+func templateOutputs(node parse.Node) (names []string) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			names = append(names, templateOutputs(child)...)
+		}
+	case *parse.ActionNode:
+		names = templateOutputs(n.Pipe)
+	case *parse.IfNode:
+		names = templateOutputs(&n.BranchNode)
+	case *parse.RangeNode:
+		names = templateOutputs(&n.BranchNode)
+	case *parse.WithNode:
+		names = templateOutputs(&n.BranchNode)
+	case *parse.BranchNode:
+		names = slices.Concat(templateOutputs(n.Pipe), templateOutputs(n.List), templateOutputs(n.ElseList))
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				names = append(names, templateOutputs(arg)...)
+			}
+		}
+	case *parse.FieldNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "Outputs" {
+			names = append(names, n.Ident[1])
+		}
+	}
+	return names
+}
+
+// hasConditionSkippedDep returns whether any of the step's dependencies was
+// skipped by its conditions, see Step.When.
+func (s *Step) hasConditionSkippedDep() (skipped bool) {
+	s.walkDeps(func(dep *Step) bool {
+		skipped = dep.Result().Status == StatusConditionSkipped
+		return !skipped
+	})
+	return skipped
+}
+
+// ExpandArgs expands the argument templates in args, see Expand.
+func ExpandArgs(ctx context.Context, args []string) (expanded []string, err error) {
+	expanded = make([]string, len(args))
+	for i, arg := range args {
+		expanded[i], err = Expand(ctx, arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+	}
+	return expanded, nil
+}
+
+// loadOutputs restores the outputs stored by the step's last run, for when
+// the step is skipped.
+func (s *Step) loadOutputs() (err error) {
+	stored, err := db.GetOutputs(CacheDb, s.name)
+	if err != nil {
+		return err
+	}
+
+	s.outputsMu.Lock()
+	defer s.outputsMu.Unlock()
+
+	s.outputs = make(map[string]any, len(stored))
+	for name, value := range stored {
+		s.outputs[name] = json.RawMessage(value)
+	}
+	return nil
+}
+
+// storeOutputs stores the step's outputs in the cache.
+func (s *Step) storeOutputs() (err error) {
+	s.outputsMu.Lock()
+	defer s.outputsMu.Unlock()
+
+	stored := make(map[string][]byte, len(s.outputs))
+	for name, value := range s.outputs {
+		b, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("output %q: %w", name, err)
+		}
+		stored[name] = b
+	}
+	return db.SetOutputs(CacheDb, s.name, stored)
+}
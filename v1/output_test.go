@@ -0,0 +1,79 @@
+package buildgo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/db"
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+// setupTestCache points the cache at a temporary database for the test, which
+// must not be parallel.
+func setupTestCache(t *testing.T) {
+	t.Helper()
+
+	conn, err := db.New(filepath.Join(t.TempDir(), "cache.db"))
+	test.NilErr(t, err)
+	CacheDb = conn
+	t.Cleanup(func() {
+		conn.Close()
+		CacheDb = nil
+	})
+}
+
+func TestExpand(t *testing.T) {
+	t.Parallel()
+
+	version := NewStep("version", commandFunc(func(ctx context.Context) error {
+		return SetOutput(ctx, "version", "v1.2.3")
+	}))
+	var expanded string
+	release := NewStep("release", commandFunc(func(ctx context.Context) (err error) {
+		expanded, err = Expand(ctx, "app-{{ .Outputs.version }}")
+		return err
+	})).DependsOn(version)
+
+	err := release.Run(context.Background())
+	test.NilErr(t, err)
+	test.AssertEqual(t, "expanded", "app-v1.2.3", expanded)
+
+	_, err = Expand(context.Background(), "{{ .Outputs.version }}")
+	test.Assert(t, "Expected expanding outside of a step to fail", err != nil)
+	s, err := Expand(context.Background(), "no templates")
+	test.NilErr(t, err)
+	test.AssertEqual(t, "without templates", "no templates", s)
+}
+
+func TestOutputsFingerprint(t *testing.T) {
+	setupTestCache(t)
+
+	src := filepath.Join(t.TempDir(), "main.go")
+	err := os.WriteFile(src, []byte("package main\n"), 0o644)
+	test.NilErr(t, err)
+
+	var runs []string
+	build := func(version string) {
+		t.Helper()
+
+		producer := NewStep("version", commandFunc(func(ctx context.Context) error {
+			return SetOutput(ctx, "version", version)
+		}))
+		consumer := NewStep("build", commandFunc(func(ctx context.Context) error {
+			v, err := Output[string](ctx, "version")
+			runs = append(runs, v)
+			return err
+		})).AddFileDeps(src).DependsOn(producer)
+
+		err := consumer.Run(context.Background())
+		test.NilErr(t, err)
+	}
+
+	build("v1")
+	build("v1")
+	test.AssertEqual(t, "runs with the same output", []string{"v1"}, runs)
+	build("v2")
+	test.AssertEqual(t, "runs once the output changed", []string{"v1", "v2"}, runs)
+}
@@ -0,0 +1,354 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/db"
+	"github.com/Genekkion/build.go/internal/util"
+)
+
+const (
+	// progressInterval is how often the progress display is redrawn on a
+	// terminal.
+	progressInterval = 200 * time.Millisecond
+	// progressLogInterval is how often progress is logged otherwise.
+	progressLogInterval = 10 * time.Second
+	// progressBarWidth is the width of the progress bar, in characters.
+	progressBarWidth = 30
+	// progressMaxRunning is the maximum number of running steps listed.
+	progressMaxRunning = 10
+)
+
+// stepState represents the state of a step in the progress display.
+type stepState int
+
+const (
+	stateQueued stepState = iota
+	stateRunning
+	stateSucceeded
+	stateSkipped
+	stateFailed
+	stateCancelled
+)
+
+// display is the progress display of the running build, if any. Guarded by
+// consoleMu.
+var display *progressDisplay
+
+// progressDisplay shows the progress of a build. On a terminal it is drawn
+// below the rest of the output and redrawn as the build progresses, otherwise
+// the progress is logged periodically.
+type progressDisplay struct {
+	tty   bool
+	start time.Time
+	// jobs is the number of steps which run at the same time, see Jobs.
+	jobs int
+	// estimates are the typical durations of steps from previous builds.
+	estimates map[string]time.Duration
+
+	mu      sync.Mutex
+	steps   []*Step
+	states  map[*Step]stepState
+	started map[*Step]time.Time
+
+	// lines is the number of lines drawn, to be cleared before the next write
+	// to the console.
+	lines int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startProgress starts showing the progress of a build of the steps, which
+// include all of their dependencies. The returned function stops it.
+func startProgress(ctx context.Context, steps []*Step) (stop func()) {
+	d := &progressDisplay{
+		tty:     util.IsTerminal(os.Stdout),
+		start:   time.Now(),
+		jobs:    Jobs,
+		steps:   steps,
+		states:  make(map[*Step]stepState, len(steps)),
+		started: map[*Step]time.Time{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	for _, s := range steps {
+		d.states[s] = stateQueued
+	}
+
+	if CacheDb != nil {
+		var err error
+		d.estimates, err = db.GetDurations(CacheDb)
+		if err != nil {
+			Logger.WarnContext(ctx, "Unable to read step durations",
+				"error", err,
+			)
+		}
+	}
+
+	consoleMu.Lock()
+	display = d
+	consoleMu.Unlock()
+
+	go d.loop(ctx)
+
+	return func() {
+		close(d.stop)
+		<-d.done
+
+		consoleMu.Lock()
+		defer consoleMu.Unlock()
+		d.clear()
+		display = nil
+	}
+}
+
+// loop redraws or logs the progress until stopped.
+func (d *progressDisplay) loop(ctx context.Context) {
+	defer close(d.done)
+
+	interval := progressLogInterval
+	if d.tty {
+		interval = progressInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+
+		if !d.tty {
+			d.log(ctx)
+			continue
+		}
+
+		consoleMu.Lock()
+		d.clear()
+		d.draw()
+		consoleMu.Unlock()
+	}
+}
+
+// setProgress sets the state of a step in the progress display, if any.
+func setProgress(s *Step, state stepState) {
+	consoleMu.Lock()
+	d := display
+	consoleMu.Unlock()
+
+	d.update(s, state)
+}
+
+// update sets the state of a step.
+func (d *progressDisplay) update(s *Step, state stepState) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.states[s]; !ok {
+		d.steps = append(d.steps, s)
+	}
+	d.states[s] = state
+	if state == stateRunning {
+		d.started[s] = time.Now()
+	}
+}
+
+// clear erases the display from a terminal. Must be called with consoleMu
+// held.
+func (d *progressDisplay) clear() {
+	if d == nil || d.lines == 0 {
+		return
+	}
+
+	// Moves the cursor up to the first line and erases to the end of the
+	// screen.
+	fmt.Fprintf(os.Stdout, "\x1b[%dA\x1b[J", d.lines)
+	d.lines = 0
+}
+
+// draw draws the display on a terminal. Must be called with consoleMu held,
+// after clear.
+func (d *progressDisplay) draw() {
+	if d == nil || !d.tty {
+		return
+	}
+
+	lines := d.render(time.Now())
+	os.Stdout.WriteString(strings.Join(lines, "\n") + "\n")
+	d.lines = len(lines)
+}
+
+// progressSummary represents a snapshot of the progress of the build.
+type progressSummary struct {
+	total    int
+	counts   map[stepState]int
+	running  []*Step
+	started  map[*Step]time.Time
+	eta      time.Duration
+	etaKnown bool
+}
+
+// summarise returns a snapshot of the progress at the given time.
+func (d *progressDisplay) summarise(now time.Time) (sum progressSummary) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sum.total = len(d.steps)
+	sum.counts = map[stepState]int{}
+	sum.started = map[*Step]time.Time{}
+
+	var (
+		known   time.Duration
+		nKnown  int
+		pending []*Step
+	)
+	for _, s := range d.steps {
+		state := d.states[s]
+		sum.counts[state]++
+		if state == stateRunning {
+			sum.running = append(sum.running, s)
+			sum.started[s] = d.started[s]
+		}
+		if state == stateQueued || state == stateRunning {
+			pending = append(pending, s)
+		}
+
+		if est, ok := d.estimates[s.name]; ok {
+			known += est
+			nKnown++
+		}
+	}
+	slices.SortFunc(sum.running, func(a, b *Step) int {
+		return d.started[a].Compare(d.started[b])
+	})
+
+	if nKnown == 0 {
+		return sum
+	}
+
+	// Steps which have not run before are assumed to take the average time.
+	average := known / time.Duration(nKnown)
+	var remaining time.Duration
+	for _, s := range pending {
+		est, ok := d.estimates[s.name]
+		if !ok {
+			est = average
+		}
+		if d.states[s] == stateRunning {
+			est = max(est-now.Sub(d.started[s]), 0)
+		}
+		remaining += est
+	}
+
+	parallel := max(min(d.jobs, len(pending)), 1)
+	sum.eta = remaining / time.Duration(parallel)
+	sum.etaKnown = true
+	return sum
+}
+
+// finished returns the number of steps which are done, however they ended.
+func (sum progressSummary) finished() int {
+	return sum.counts[stateSucceeded] + sum.counts[stateSkipped] + sum.counts[stateFailed] +
+		sum.counts[stateCancelled]
+}
+
+// render returns the lines of the display at the given time.
+func (d *progressDisplay) render(now time.Time) (lines []string) {
+	sum := d.summarise(now)
+
+	finished := sum.finished()
+	filled := 0
+	if sum.total > 0 {
+		filled = finished * progressBarWidth / sum.total
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "[%s%s] %d/%d steps", strings.Repeat("=", filled), strings.Repeat(" ", progressBarWidth-filled),
+		finished, sum.total)
+	fmt.Fprintf(&b, ", %d running, %d queued, %d skipped", len(sum.running), sum.counts[stateQueued], sum.counts[stateSkipped])
+	if n := sum.counts[stateFailed]; n > 0 {
+		fmt.Fprintf(&b, ", %d failed", n)
+	}
+	if n := sum.counts[stateCancelled]; n > 0 {
+		fmt.Fprintf(&b, ", %d cancelled", n)
+	}
+	fmt.Fprintf(&b, " | %s", formatDuration(now.Sub(d.start)))
+	if sum.etaKnown {
+		fmt.Fprintf(&b, ", ETA %s", formatDuration(sum.eta))
+	}
+	lines = append(lines, b.String())
+
+	for i, s := range sum.running {
+		if i == progressMaxRunning {
+			lines = append(lines, fmt.Sprintf("  ... and %d more", len(sum.running)-i))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("  > %s %s", s.name, formatDuration(now.Sub(sum.started[s]))))
+	}
+	return lines
+}
+
+// log logs the progress, for when the console is not a terminal.
+func (d *progressDisplay) log(ctx context.Context) {
+	now := time.Now()
+	sum := d.summarise(now)
+
+	running := make([]string, len(sum.running))
+	for i, s := range sum.running {
+		running[i] = fmt.Sprintf("%s (%s)", s.name, formatDuration(now.Sub(sum.started[s])))
+	}
+
+	attrs := []any{
+		"done", sum.finished(),
+		"total", sum.total,
+		"running", running,
+		"queued", sum.counts[stateQueued],
+		"skipped", sum.counts[stateSkipped],
+		"failed", sum.counts[stateFailed],
+		"cancelled", sum.counts[stateCancelled],
+		"elapsed", now.Sub(d.start).Round(time.Second),
+	}
+	if sum.etaKnown {
+		attrs = append(attrs, "eta", sum.eta.Round(time.Second))
+	}
+	Logger.InfoContext(ctx, "Build progress", attrs...)
+}
+
+// formatDuration formats a duration to a tenth of a second, or a second once
+// it is over a minute.
+func formatDuration(d time.Duration) string {
+	if d >= time.Minute {
+		return d.Round(time.Second).String()
+	}
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
+
+// stateOf returns the progress state for a step's status.
+func stateOf(status Status) stepState {
+	switch status {
+	case StatusSucceeded:
+		return stateSucceeded
+	case StatusSkipped, StatusConditionSkipped:
+		return stateSkipped
+	case StatusFailed:
+		return stateFailed
+	case StatusCancelled:
+		return stateCancelled
+	default:
+		return stateQueued
+	}
+}
@@ -0,0 +1,50 @@
+package buildgo
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestProgressRender(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	build := &Step{name: "build"}
+	lint := &Step{name: "lint"}
+	deploy := &Step{name: "deploy"}
+	d := &progressDisplay{
+		start: now.Add(-3 * time.Second),
+		jobs:  4,
+		estimates: map[string]time.Duration{
+			"build":  4 * time.Second,
+			"deploy": 10 * time.Second,
+		},
+		steps: []*Step{lint, build, deploy},
+		states: map[*Step]stepState{
+			lint:   stateSkipped,
+			build:  stateRunning,
+			deploy: stateQueued,
+		},
+		started: map[*Step]time.Time{
+			build: now.Add(-time.Second),
+		},
+	}
+
+	sum := d.summarise(now)
+	test.Assert(t, "Expected ETA to be known", sum.etaKnown)
+	// 3s left of build and 10s of deploy, split between the 2 pending steps.
+	test.AssertEqual(t, "eta", 6500*time.Millisecond, sum.eta)
+
+	d.jobs = 1
+	sum = d.summarise(now)
+	test.AssertEqual(t, "eta with 1 job", 13*time.Second, sum.eta)
+
+	lines := d.render(now)
+	test.AssertEqual(t, "Expected a line per running step", 2, len(lines))
+	test.Assert(t, "Unexpected summary: "+lines[0],
+		strings.Contains(lines[0], "] 1/3 steps, 1 running, 1 queued, 1 skipped | 3.0s, ETA "))
+	test.AssertEqual(t, "running", "  > build 1.0s", lines[1])
+}
@@ -0,0 +1,300 @@
+package buildgo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/junit"
+)
+
+// ReportFormat represents the format of a build report.
+type ReportFormat string
+
+const (
+	// ReportJUnit is JUnit XML with a test case per step, which CI systems
+	// render natively.
+	ReportJUnit ReportFormat = "junit"
+	// ReportJSON is JSON in the schema of JSONReport.
+	ReportJSON ReportFormat = "json"
+)
+
+// JSONReportVersion is the version of the schema of JSONReport. It changes
+// whenever a field is removed or its meaning changes.
+const JSONReportVersion = 1
+
+// reportOutputLimit is the maximum size of the output of a failed step
+// included in a report, from the end of its log.
+const reportOutputLimit = 64 * 1024
+
+// reportSpec represents a report to be written, in the form "format:path".
+type reportSpec struct {
+	format ReportFormat
+	path   string
+}
+
+// parseReportSpec parses a report of the form "format:path".
+func parseReportSpec(s string) (spec reportSpec, err error) {
+	format, path, ok := strings.Cut(s, ":")
+	if !ok || path == "" {
+		return spec, fmt.Errorf("invalid report %q, expected format:path", s)
+	}
+
+	spec = reportSpec{
+		format: ReportFormat(format),
+		path:   path,
+	}
+	switch spec.format {
+	case ReportJUnit, ReportJSON:
+		return spec, nil
+	default:
+		return spec, fmt.Errorf("invalid report format %q, expected junit or json", format)
+	}
+}
+
+// JSONReport represents the outcome of a build for dashboards. See
+// JSONReportVersion.
+type JSONReport struct {
+	Version    int       `json:"version"`
+	BuildID    string    `json:"buildId"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	DurationMs float64   `json:"durationMs"`
+	// Outcome is "succeeded" or "failed".
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+	// Roots are the steps the build was run for.
+	Roots []string `json:"roots"`
+	// Graph maps each step to the steps it depends on.
+	Graph map[string][]string `json:"graph"`
+	// Steps are the results of the steps, in dependency order.
+	Steps []JSONStep     `json:"steps"`
+	Cache JSONCacheStats `json:"cache"`
+}
+
+// JSONStep represents the result of a step in a JSONReport.
+type JSONStep struct {
+	Name string `json:"name"`
+	// Status is "succeeded", "failed", "skipped" when up to date, "skipped
+	// (condition)" when one of its conditions, or of a step depending on it,
+	// did not hold, "cancelled" if the build was cancelled while it ran, or
+	// "pending" if the step did not run, e.g. as the build was cancelled.
+	Status     string        `json:"status"`
+	Reason     string        `json:"reason,omitempty"`
+	Start      *time.Time    `json:"start,omitempty"`
+	DurationMs float64       `json:"durationMs"`
+	Attempts   int           `json:"attempts"`
+	ExitCode   *int          `json:"exitCode,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	LogPath    string        `json:"logPath,omitempty"`
+	Commands   []JSONCommand `json:"commands,omitempty"`
+}
+
+// JSONCommand represents the outcome of a command in a JSONStep.
+type JSONCommand struct {
+	Name       string  `json:"name"`
+	DurationMs float64 `json:"durationMs"`
+	ExitCode   int     `json:"exitCode"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// JSONCacheStats represents how well the cache did in a build. Steps without
+// file dependencies are never cached, so are counted separately.
+type JSONCacheStats struct {
+	Hits     int     `json:"hits"`
+	Misses   int     `json:"misses"`
+	Uncached int     `json:"uncached"`
+	HitRate  float64 `json:"hitRate"`
+}
+
+// writeReports writes the reports of the build of the targets.
+func writeReports(specs []reportSpec, start time.Time, end time.Time, targets []*Step, buildErr error) (err error) {
+	var errs []error
+	for _, spec := range specs {
+		errs = append(errs, writeReport(spec, start, end, targets, buildErr))
+	}
+	return errors.Join(errs...)
+}
+
+// writeReport writes a report of the build of the targets.
+func writeReport(spec reportSpec, start time.Time, end time.Time, targets []*Step, buildErr error) (err error) {
+	f, err := os.Create(spec.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch spec.format {
+	case ReportJUnit:
+		err = junit.Write(f, junitReport(start, end, graph(targets)))
+	case ReportJSON:
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(jsonReport(start, end, targets, buildErr))
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// junitReport returns the build as a test suite with a test case per step.
+// Up to date steps and those which did not run are skipped, with the reason.
+func junitReport(start time.Time, end time.Time, steps []*Step) (suites junit.Suites) {
+	suite := junit.Suite{
+		Name:      "build",
+		Time:      junit.NewSeconds(end.Sub(start)),
+		Timestamp: start.Format(time.RFC3339),
+	}
+	for _, s := range steps {
+		res := s.Result()
+		c := junit.Case{
+			Name:      s.name,
+			Classname: "build",
+			Time:      junit.NewSeconds(res.Duration),
+		}
+
+		switch {
+		case res.Status == StatusSkipped, res.Status == StatusConditionSkipped:
+			c.Skipped = &junit.Message{Message: res.Reason}
+		case res.Status == StatusFailed && (res.Attempts > 0 || res.Reason != ""):
+			// The step itself failed, rather than one of its dependencies.
+			c.Failure = &junit.Message{
+				Message: res.Err.Error(),
+				Body:    failureOutput(res.LogPath),
+			}
+			if res.Attempts > 0 {
+				c.Failure.Type = fmt.Sprintf("exit code %d", exitCode(res.Err))
+			}
+		case res.Status == StatusFailed:
+			c.Skipped = &junit.Message{Message: "not run: " + res.Err.Error()}
+		case res.Status == StatusCancelled:
+			c.Skipped = &junit.Message{Message: "cancelled: " + res.Err.Error()}
+		case res.Status == StatusPending:
+			c.Skipped = &junit.Message{Message: "not run"}
+		}
+		suite.Add(c)
+	}
+
+	suites.Name = "build " + BuildID
+	suites.Add(suite)
+	return suites
+}
+
+// failureOutput returns the end of the output of a failed step from its log,
+// if any.
+func failureOutput(fp string) string {
+	if fp == "" {
+		return ""
+	}
+	f, err := os.Open(fp)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return ""
+	}
+	var prefix string
+	if info.Size() > reportOutputLimit {
+		_, err = f.Seek(-reportOutputLimit, io.SeekEnd)
+		if err != nil {
+			return ""
+		}
+		prefix = "[output truncated]\n"
+	}
+
+	out, err := io.ReadAll(f)
+	if err != nil {
+		return ""
+	}
+	return prefix + string(out)
+}
+
+// jsonReport returns the build as a JSONReport.
+func jsonReport(start time.Time, end time.Time, targets []*Step, buildErr error) (report JSONReport) {
+	report = JSONReport{
+		Version:    JSONReportVersion,
+		BuildID:    BuildID,
+		Start:      start,
+		End:        end,
+		DurationMs: milliseconds(end.Sub(start)),
+		Outcome:    string(StatusSucceeded),
+		Roots:      []string{},
+		Graph:      map[string][]string{},
+		Steps:      []JSONStep{},
+	}
+	if buildErr != nil {
+		report.Outcome = string(StatusFailed)
+		report.Error = buildErr.Error()
+	}
+	for _, s := range targets {
+		report.Roots = append(report.Roots, s.name)
+	}
+
+	for _, s := range graph(targets) {
+		deps := make([]string, len(s.dependsOn))
+		for i, dep := range s.dependsOn {
+			deps[i] = dep.name
+		}
+		report.Graph[s.name] = deps
+
+		res := s.Result()
+		step := JSONStep{
+			Name:       s.name,
+			Status:     string(res.Status),
+			Reason:     res.Reason,
+			DurationMs: milliseconds(res.Duration),
+			Attempts:   res.Attempts,
+			LogPath:    res.LogPath,
+		}
+		if !res.Start.IsZero() {
+			step.Start = &res.Start
+		}
+		if res.Err != nil {
+			step.Error = res.Err.Error()
+		}
+		if res.Attempts > 0 {
+			code := exitCode(res.Err)
+			step.ExitCode = &code
+		}
+		for _, cmd := range res.Commands {
+			jc := JSONCommand{
+				Name:       cmd.Name,
+				DurationMs: milliseconds(cmd.Duration),
+				ExitCode:   exitCode(cmd.Err),
+			}
+			if cmd.Err != nil {
+				jc.Error = cmd.Err.Error()
+			}
+			step.Commands = append(step.Commands, jc)
+		}
+		report.Steps = append(report.Steps, step)
+
+		switch {
+		case res.Status == StatusSkipped:
+			report.Cache.Hits++
+		case res.Attempts == 0:
+			// Did not run.
+		case len(s.fileDepsPatterns) > 0:
+			report.Cache.Misses++
+		default:
+			report.Cache.Uncached++
+		}
+	}
+	if n := report.Cache.Hits + report.Cache.Misses; n > 0 {
+		report.Cache.HitRate = float64(report.Cache.Hits) / float64(n)
+	}
+	return report
+}
+
+// milliseconds returns the duration in fractional milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,44 @@
+package buildgo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestReports(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	errTest := errors.New("exit status 1")
+	gen := &Step{name: "generate", fileDepsPatterns: []string{"*.go"}}
+	gen.setResult(Result{Status: StatusSkipped, Reason: "up to date", Start: start})
+	build := (&Step{name: "build", fileDepsPatterns: []string{"*.go"}}).DependsOn(gen)
+	build.setResult(Result{Status: StatusFailed, Err: errTest, Attempts: 1, Start: start, Duration: time.Second})
+	deploy := (&Step{name: "deploy"}).DependsOn(build)
+	deploy.setResult(Result{Status: StatusFailed, Err: errTest})
+
+	suites := junitReport(start, start.Add(time.Second), graph([]*Step{deploy}))
+	test.AssertEqual(t, "tests", 3, suites.Tests)
+	test.AssertEqual(t, "failures", 1, suites.Failures)
+	test.AssertEqual(t, "skipped", 2, suites.Skipped)
+	test.AssertEqual(t, "skip reason", "up to date", suites.Suites[0].Cases[0].Skipped.Message)
+	test.AssertEqual(t, "not run", "not run: exit status 1", suites.Suites[0].Cases[2].Skipped.Message)
+
+	report := jsonReport(start, start.Add(time.Second), []*Step{deploy}, errTest)
+	test.AssertEqual(t, "version", JSONReportVersion, report.Version)
+	test.AssertEqual(t, "outcome", "failed", report.Outcome)
+	test.AssertEqual(t, "graph", []string{"build"}, report.Graph["deploy"])
+	test.AssertEqual(t, "steps", 3, len(report.Steps))
+	test.AssertEqual(t, "hits", 1, report.Cache.Hits)
+	test.AssertEqual(t, "misses", 1, report.Cache.Misses)
+	test.AssertEqual(t, "hit rate", 0.5, report.Cache.HitRate)
+
+	_, err := parseReportSpec("xml:report.xml")
+	test.Assert(t, "Expected invalid format to fail", err != nil)
+	spec, err := parseReportSpec("junit:out/report.xml")
+	test.NilErr(t, err)
+	test.AssertEqual(t, "path", "out/report.xml", spec.path)
+}
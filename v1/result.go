@@ -0,0 +1,74 @@
+package buildgo
+
+import (
+	"time"
+)
+
+// Status represents the status of a step.
+type Status string
+
+const (
+	// StatusPending means the step has not run yet.
+	StatusPending Status = "pending"
+	// StatusSucceeded means the step's commands ran successfully.
+	StatusSucceeded Status = "succeeded"
+	// StatusFailed means the step or one of its dependencies failed.
+	StatusFailed Status = "failed"
+	// StatusSkipped means the step was up to date and did not need to run.
+	StatusSkipped Status = "skipped"
+	// StatusConditionSkipped means the step did not run as one of its
+	// conditions, or of a step depending on it, did not hold, see Step.When.
+	StatusConditionSkipped Status = "skipped (condition)"
+	// StatusCancelled means the step was stopped before it completed as the
+	// build was cancelled, e.g. after another step failed.
+	StatusCancelled Status = "cancelled"
+)
+
+// Result represents the outcome of a step.
+type Result struct {
+	Status   Status
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+	// Reason is why the step was run or skipped, e.g. "files changed: main.go".
+	Reason string
+	// Attempts is the number of times the step's commands were run.
+	Attempts int
+	// SpanID identifies the step's span in the trace of the build, in hex.
+	SpanID string
+	// Slot is the worker slot the step's commands ran in, numbered from 1, or
+	// 0 if they did not run.
+	Slot int
+	// Commands are the outcomes of the step's commands, in the order they
+	// ran.
+	Commands []CommandResult
+	// LogPath is the file the output of the step's commands was written to,
+	// if it ran.
+	LogPath string
+	// Reports are the structured reports of the step's commands, see
+	// Reporter.
+	Reports []any
+}
+
+// CommandResult represents the outcome of one of a step's commands.
+type CommandResult struct {
+	// Name describes the command, see CommandName.
+	Name string
+	// SpanID identifies the command's span in the trace of the build, in
+	// hex.
+	SpanID   string
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// Report returns the first report of type T from the step's result.
+func Report[T any](s *Step) (report T, ok bool) {
+	for _, r := range s.Result().Reports {
+		report, ok = r.(T)
+		if ok {
+			return report, true
+		}
+	}
+	return report, false
+}
@@ -0,0 +1,213 @@
+package buildgo
+
+import (
+	"container/heap"
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/db"
+)
+
+var (
+	// Jobs is the maximum number of steps which run their commands at the
+	// same time. Must be set before the first step is run.
+	Jobs = runtime.NumCPU()
+
+	// pool holds the worker slots.
+	pool     *slotPool
+	poolOnce sync.Once
+)
+
+// slotPool represents the worker slots. Steps waiting for a slot get one in
+// order of priority, and then of arrival.
+type slotPool struct {
+	mu      sync.Mutex
+	free    []int
+	waiters waiterQueue
+	seq     int
+}
+
+// waiter represents a step waiting for a worker slot.
+type waiter struct {
+	priority time.Duration
+	seq      int
+	slot     chan int
+	// index is the waiter's index in the queue, or -1 once it is removed.
+	index int
+}
+
+// acquireSlot blocks until a worker slot is free for the step, returning its
+// id. Steps on the longest path through the rest of the build go first, see
+// prioritise.
+func acquireSlot(ctx context.Context, s *Step) (slot int, err error) {
+	poolOnce.Do(func() {
+		n := max(Jobs, 1)
+		pool = &slotPool{}
+		for i := range n {
+			pool.free = append(pool.free, i)
+		}
+	})
+
+	pool.mu.Lock()
+	if len(pool.free) > 0 && len(pool.waiters) == 0 {
+		slot = pool.free[0]
+		pool.free = pool.free[1:]
+		pool.mu.Unlock()
+		return slot, nil
+	}
+
+	w := &waiter{
+		priority: s.priority,
+		seq:      pool.seq,
+		slot:     make(chan int, 1),
+	}
+	pool.seq++
+	heap.Push(&pool.waiters, w)
+	pool.mu.Unlock()
+
+	select {
+	case slot = <-w.slot:
+		return slot, nil
+	case <-ctx.Done():
+		pool.mu.Lock()
+		if w.index >= 0 {
+			heap.Remove(&pool.waiters, w.index)
+			pool.mu.Unlock()
+			return 0, ctx.Err()
+		}
+		pool.mu.Unlock()
+
+		// A slot was handed over just as the context was cancelled.
+		releaseSlot(<-w.slot)
+		return 0, ctx.Err()
+	}
+}
+
+// releaseSlot frees a worker slot acquired with acquireSlot, handing it over
+// to the waiting step with the highest priority.
+func releaseSlot(slot int) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if len(pool.waiters) == 0 {
+		pool.free = append(pool.free, slot)
+		return
+	}
+	w := heap.Pop(&pool.waiters).(*waiter)
+	w.slot <- slot
+}
+
+// waiterQueue is a heap of waiters, highest priority first.
+type waiterQueue []*waiter
+
+func (q waiterQueue) Len() int {
+	return len(q)
+}
+
+func (q waiterQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q waiterQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *waiterQueue) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waiterQueue) Pop() any {
+	old := *q
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	w.index = -1
+	*q = old[:len(old)-1]
+	return w
+}
+
+// prioritise sets the priority of each of the steps, which include all of
+// their dependencies, to the estimated duration of the longest path from the
+// step to the end of the build, using the durations of previous builds. Steps
+// on the critical path are then given worker slots first.
+func prioritise(steps []*Step) {
+	if CacheDb == nil {
+		return
+	}
+	durations, err := db.GetDurations(CacheDb)
+	if err != nil {
+		Logger.Warn("Unable to read step durations",
+			"error", err,
+		)
+		return
+	}
+
+	// Steps which have not run before are assumed to take the average time.
+	var average time.Duration
+	if len(durations) > 0 {
+		for _, d := range durations {
+			average += d
+		}
+		average /= time.Duration(len(durations))
+	}
+
+	dependents := map[*Step][]*Step{}
+	for _, s := range steps {
+		for _, dep := range s.dependsOn {
+			dependents[dep] = append(dependents[dep], s)
+		}
+	}
+
+	// Steps are in dependency order, so dependents are prioritised before
+	// their dependencies when going backwards.
+	for i := len(steps) - 1; i >= 0; i-- {
+		s := steps[i]
+		var longest time.Duration
+		for _, d := range dependents[s] {
+			longest = max(longest, d.priority)
+		}
+		est, ok := durations[s.name]
+		if !ok {
+			est = average
+		}
+		s.priority = est + longest
+	}
+}
+
+// runSteps runs the steps in parallel, returning the first error encountered.
+// The remaining steps are cancelled once one of them fails.
+func runSteps(ctx context.Context, steps []*Step) (err error) {
+	if len(steps) == 1 {
+		return steps[0].Run(ctx)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg   sync.WaitGroup
+		once sync.Once
+	)
+	for _, step := range steps {
+		wg.Go(func() {
+			stepErr := step.Run(ctx)
+			if stepErr != nil {
+				once.Do(func() {
+					err = stepErr
+					cancel()
+				})
+			}
+		})
+	}
+	wg.Wait()
+
+	return err
+}
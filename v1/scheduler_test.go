@@ -0,0 +1,32 @@
+package buildgo
+
+import (
+	"container/heap"
+	"testing"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestWaiterQueue(t *testing.T) {
+	t.Parallel()
+
+	var q waiterQueue
+	short := &waiter{priority: time.Second, seq: 0}
+	long := &waiter{priority: time.Minute, seq: 1}
+	first := &waiter{priority: time.Second, seq: 2}
+	removed := &waiter{priority: time.Hour, seq: 3}
+	for _, w := range []*waiter{short, long, first, removed} {
+		heap.Push(&q, w)
+	}
+
+	heap.Remove(&q, removed.index)
+	test.AssertEqual(t, "removed index", -1, removed.index)
+
+	// Highest priority first, then in order of arrival.
+	for _, want := range []*waiter{long, short, first} {
+		got := heap.Pop(&q).(*waiter)
+		test.AssertEqual(t, "seq", want.seq, got.seq)
+	}
+	test.AssertEqual(t, "len", 0, q.Len())
+}
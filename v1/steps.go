@@ -2,31 +2,102 @@ package buildgo
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"maps"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/db"
+	"github.com/Genekkion/build.go/internal/log/slog"
 )
 
 // Step represents a single build step.
 type Step struct {
 	name             string
+	description      string
+	tags             []string
 	commands         []Command
 	dependsOn        []*Step
 	fileDepsPatterns []string
+	alwaysRun        bool
+	neverCache       bool
+	conditions       []Condition
+	required         bool
 	done             atomic.Bool
+	// users counts the running steps which depend on the step, directly or
+	// not, so that its commands are only stopped once none of them need it,
+	// see stopDeps.
+	users atomic.Int32
+
+	// mu is held while the step runs, so that dependents running in parallel
+	// wait for a single run of the step.
+	mu sync.Mutex
+	// err is the error of the step's run, if it failed.
+	err error
+
+	result   Result
+	resultMu sync.Mutex
+
+	outputs   map[string]any
+	outputsMu sync.Mutex
+
+	// log captures the output of the step's commands while it runs.
+	log *stepLog
+	// priority orders the step's claim on a worker slot, see prioritise.
+	priority time.Duration
+	// forced is set for steps to be rebuilt regardless of the cache, see the
+	// -force flag of Main.
+	forced bool
 }
 
-// NewStep creates a new step.
+// NewStep creates a new step. A step without commands only groups its
+// dependencies, see Group.
 func NewStep(name string, commands ...Command) *Step {
-	if len(commands) == 0 {
-		panic("step needs at least 1 command")
-	}
-
 	return &Step{
 		name:     name,
 		commands: commands,
 	}
 }
 
+// Group creates a step which runs the given steps, e.g. "ci" for everything
+// run in CI, so that they can be selected by a single name.
+func Group(name string, steps ...*Step) *Step {
+	return NewStep(name).DependsOn(steps...)
+}
+
+// Describe sets the description of the step, shown by the list subcommand of
+// Main.
+func (s *Step) Describe(text string) *Step {
+	s.description = text
+	return s
+}
+
+// Description returns the description of the step.
+func (s *Step) Description() string {
+	return s.description
+}
+
+// Tags adds tags to the step, e.g. "lint" or "release", for selecting steps
+// on the command line, see Main.
+func (s *Step) Tags(tags ...string) *Step {
+	for _, tag := range tags {
+		if !slices.Contains(s.tags, tag) {
+			s.tags = append(s.tags, tag)
+		}
+	}
+	return s
+}
+
+// HasTag returns whether the step has the tag.
+func (s *Step) HasTag(tag string) bool {
+	return slices.Contains(s.tags, tag)
+}
+
 // DependsOn adds a dependency on other steps.
 func (s *Step) DependsOn(steps ...*Step) *Step {
 	s.dependsOn = append(s.dependsOn, steps...)
@@ -52,6 +123,38 @@ func (s *Step) AddFileDeps(patterns ...string) *Step {
 	return s
 }
 
+// AlwaysRun makes the step run on every build, even if its file dependencies
+// are up to date. The cache is still updated, so that the step is skipped as
+// usual once AlwaysRun is removed.
+func (s *Step) AlwaysRun() *Step {
+	s.alwaysRun = true
+	return s
+}
+
+// NeverCache makes the step run on every build without reading or updating
+// the cache, e.g. for steps whose file dependencies are only informational.
+func (s *Step) NeverCache() *Step {
+	s.neverCache = true
+	return s
+}
+
+// When adds conditions for the step to run, all of which must hold, e.g.
+// When(OnOS("linux"), EnvEquals("CI", "true")). Otherwise the step and its
+// dependencies are skipped without blocking its dependents, unless it is
+// Required. The outputs of skipped steps are unavailable to their dependents,
+// see ErrOutputUnavailable.
+func (s *Step) When(conds ...Condition) *Step {
+	s.conditions = append(s.conditions, conds...)
+	return s
+}
+
+// Required makes the step fail if its conditions do not hold, so that its
+// dependents do not run either.
+func (s *Step) Required() *Step {
+	s.required = true
+	return s
+}
+
 // SetFileDeps sets the file dependencies.
 func (s *Step) SetFileDeps(patterns []string) *Step {
 	s.fileDepsPatterns = patterns
@@ -73,23 +176,44 @@ func (s *Step) Commands() []Command {
 	return s.commands
 }
 
+// Result returns the outcome of the step's run.
+func (s *Step) Result() Result {
+	s.resultMu.Lock()
+	defer s.resultMu.Unlock()
+
+	if s.result.Status == "" {
+		return Result{Status: StatusPending}
+	}
+	return s.result
+}
+
+// setResult sets the outcome of the step's run.
+func (s *Step) setResult(res Result) {
+	s.resultMu.Lock()
+	defer s.resultMu.Unlock()
+
+	s.result = res
+}
+
 // Done returns whether the step has been completed.
 func (s *Step) Done() bool {
 	return s.done.Load()
 }
 
 // needsRebuild returns nil if the step can be skipped, or a map of files which
-// hashes are to be updated after the step is run.
-func (s *Step) needsRebuild() (toSet map[string][]byte, err error) {
+// hashes are to be updated after the step is run. The fingerprint of the
+// step's commands is returned if it has changed, to be stored after the step
+// is run.
+func (s *Step) needsRebuild() (toSet map[string][]byte, fingerprint []byte, err error) {
 	toSet = map[string][]byte{}
 	if len(s.fileDepsPatterns) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	for _, fileDep := range s.fileDepsPatterns {
 		files, err := filepath.Glob(fileDep)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		Logger.Debug("Files matched",
@@ -100,7 +224,7 @@ func (s *Step) needsRebuild() (toSet map[string][]byte, err error) {
 		for _, fp := range files {
 			h, err := needsRebuild(fp)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			if h != nil {
 				toSet[fp] = h
@@ -108,8 +232,44 @@ func (s *Step) needsRebuild() (toSet map[string][]byte, err error) {
 		}
 	}
 
-	s.done.Store(len(toSet) == 0)
-	return toSet, nil
+	fingerprint = s.fingerprint()
+	if fingerprint != nil {
+		stored, err := GetFingerprint(s.name)
+		if err != nil {
+			return nil, nil, err
+		} else if slices.Equal(stored, fingerprint) {
+			fingerprint = nil
+		}
+	}
+
+	s.done.Store(len(toSet) == 0 && fingerprint == nil)
+	return toSet, fingerprint, nil
+}
+
+// fingerprint returns the combined fingerprint of the step's commands and of
+// the outputs of its dependencies, or nil if there are neither. A change in
+// the outputs, e.g. in a version used in an argument template, causes the step
+// to be rebuilt.
+func (s *Step) fingerprint() []byte {
+	h := Hasher()
+	found := false
+	for _, cmd := range s.commands {
+		f, ok := cmd.(Fingerprinter)
+		if !ok {
+			continue
+		}
+
+		found = true
+		h.Write(f.Fingerprint())
+	}
+	if s.hashOutputs(h) {
+		found = true
+	}
+
+	if !found {
+		return nil
+	}
+	return h.Sum(nil)
 }
 
 // Run runs the step.
@@ -118,34 +278,180 @@ func (s *Step) Run(ctx context.Context) (err error) {
 		return nil
 	}
 
-	for _, dep := range s.dependsOn {
-		if dep.Done() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Done() {
+		return nil
+	} else if s.err != nil {
+		return s.err
+	}
+
+	res := Result{
+		Status: StatusPending,
+	}
+	err = s.run(ctx, &res)
+	if !res.Start.IsZero() {
+		res.Duration = time.Since(res.Start)
+	}
+	for _, cmd := range s.commands {
+		reporter, ok := cmd.(Reporter)
+		if !ok {
 			continue
 		}
+		if report := reporter.Report(); report != nil {
+			res.Reports = append(res.Reports, report)
+		}
+	}
+	if err != nil && ctx.Err() != nil {
+		// The step may run again in a later build, so the error is not kept.
+		res.Status = StatusCancelled
+		res.Err = err
+		s.stopDeps(ctx)
+	} else if err != nil {
+		res.Status = StatusFailed
+		res.Err = err
+		s.err = err
+		s.stopDeps(ctx)
+	}
+	s.setResult(res)
+	setProgress(s, stateOf(res.Status))
+
+	if res.Status == StatusSucceeded && CacheDb != nil {
+		durErr := db.AddDuration(CacheDb, s.name, res.Duration)
+		if durErr != nil {
+			Logger.WarnContext(ctx, "Unable to record step duration",
+				"step", s.name,
+				"error", durErr,
+			)
+		}
+	}
+
+	return err
+}
 
-		err = dep.Run(ctx)
+// run runs the step's dependencies in parallel, followed by its commands,
+// recording the outcome in res.
+func (s *Step) run(ctx context.Context, res *Result) (err error) {
+	for _, c := range s.conditions {
+		if c.Check() {
+			continue
+		}
+
+		res.Reason = "condition not met: " + c.Name
+		if s.required {
+			return errors.New(res.Reason)
+		}
+		Logger.InfoContext(ctx, "Skipping step",
+			"step", s.name,
+			"reason", res.Reason,
+		)
+		res.Status = StatusConditionSkipped
+		s.done.Store(true)
+		s.skipDeps(res.Reason)
+		return nil
+	}
+
+	s.holdDeps(1)
+	defer s.holdDeps(-1)
+	err = runSteps(ctx, slices.DeleteFunc(slices.Clone(s.dependsOn), (*Step).Done))
+	if err != nil {
+		return err
+	}
+
+	// The span starts after the dependencies have run, so that they are
+	// children of the build rather than of whichever dependent ran them.
+	ctx = withStep(slog.CtxWithSpan(ctx), s)
+	spanId, _ := slog.SpanFromCtx(ctx)
+	res.SpanID = spanId.String()
+	res.Start = time.Now()
+
+	if len(s.commands) == 0 {
+		res.Reason = "group"
+		res.Status = StatusSucceeded
+		s.done.Store(true)
+		return nil
+	}
+
+	var (
+		toSet       map[string][]byte
+		fingerprint []byte
+	)
+	res.Reason = "no file dependencies"
+	cached := len(s.fileDepsPatterns) > 0 && !s.neverCache
+	upToDate := false
+	if cached {
+		toSet, fingerprint, err = s.needsRebuild()
 		if err != nil {
 			return err
 		}
+		res.Reason = rebuildReason(toSet, fingerprint)
+		upToDate = len(toSet) == 0 && fingerprint == nil
 	}
-
-	var toSet map[string][]byte
-	if len(s.fileDepsPatterns) > 0 {
-		toSet, err = s.needsRebuild()
+	switch {
+	case cached && !upToDate:
+		// Changes are reason enough.
+	case s.forced:
+		res.Reason = "forced"
+	case s.neverCache:
+		res.Reason = "never cached"
+	case s.alwaysRun:
+		res.Reason = "always run"
+	case upToDate:
+		Logger.InfoContext(ctx, "Skipping step", "step", s.name)
+		err = s.loadOutputs()
 		if err != nil {
 			return err
-		} else if len(toSet) == 0 {
-			Logger.Info("Skipping step", "step", s.name)
-			s.done.Store(true)
-			return nil
 		}
+		res.Status = StatusSkipped
+		s.done.Store(true)
+		return nil
+	}
+
+	slot, err := acquireSlot(ctx, s)
+	if err != nil {
+		return err
 	}
+	defer releaseSlot(slot)
+	res.Slot = slot + 1
+	// Time spent waiting for a slot is not part of the step's duration.
+	res.Start = time.Now()
 
-	Logger.Info("Running step", "step", s.name)
+	s.log, err = newStepLog(s.name)
+	if err != nil {
+		return err
+	}
+	res.LogPath = s.log.path
+	defer func() {
+		s.log.finish(err != nil)
+	}()
+
+	setProgress(s, stateRunning)
+	res.Attempts++
+	Logger.InfoContext(ctx, "Running step",
+		"step", s.name,
+		"reason", res.Reason,
+	)
 	for _, cmd := range s.commands {
-		err = cmd.Run(ctx)
-		if err != nil {
-			Logger.Error("Step failed",
+		cmdCtx := slog.CtxWithSpan(ctx)
+		spanId, _ := slog.SpanFromCtx(cmdCtx)
+		cmdRes := CommandResult{
+			Name:   CommandName(cmd),
+			SpanID: spanId.String(),
+			Start:  time.Now(),
+		}
+		err = cmd.Run(cmdCtx)
+		cmdRes.Duration = time.Since(cmdRes.Start)
+		cmdRes.Err = err
+		res.Commands = append(res.Commands, cmdRes)
+		if err != nil && ctx.Err() != nil {
+			Logger.WarnContext(ctx, "Step cancelled",
+				"step", s.name,
+				"error", err,
+			)
+			return err
+		} else if err != nil {
+			Logger.ErrorContext(ctx, "Step failed",
 				"step", s.name,
 				"error", err,
 			)
@@ -153,13 +459,14 @@ func (s *Step) Run(ctx context.Context) (err error) {
 		}
 	}
 
-	Logger.Info("Step completed", "step", s.name)
+	Logger.InfoContext(ctx, "Step completed", "step", s.name)
+	res.Status = StatusSucceeded
 	s.done.Store(true)
 
 	for fp, h := range toSet {
 		err = SetHash(fp, h)
 		if err != nil {
-			Logger.Error("Unable to update cache for file",
+			Logger.ErrorContext(ctx, "Unable to update cache for file",
 				"file", fp,
 				"error", err,
 			)
@@ -168,5 +475,125 @@ func (s *Step) Run(ctx context.Context) (err error) {
 		}
 	}
 
+	if cached {
+		err = s.storeOutputs()
+		if err != nil {
+			Logger.ErrorContext(ctx, "Unable to update cache for step outputs",
+				"step", s.name,
+				"error", err,
+			)
+
+			return err
+		}
+	}
+
+	if fingerprint != nil {
+		err = SetFingerprint(s.name, fingerprint)
+		if err != nil {
+			Logger.ErrorContext(ctx, "Unable to update cache for step",
+				"step", s.name,
+				"error", err,
+			)
+
+			return err
+		}
+	}
+
 	return nil
 }
+
+// rebuildReason describes why a step with file dependencies is run, given the
+// changes found by needsRebuild.
+func rebuildReason(toSet map[string][]byte, fingerprint []byte) string {
+	var reasons []string
+	if len(toSet) > 0 {
+		files := slices.Sorted(maps.Keys(toSet))
+		if len(files) > 3 {
+			files = append(files[:3], fmt.Sprintf("and %d more", len(toSet)-3))
+		}
+		reasons = append(reasons, "files changed: "+strings.Join(files, ", "))
+	}
+	if fingerprint != nil {
+		reasons = append(reasons, "configuration or outputs of dependencies changed")
+	}
+	if len(reasons) == 0 {
+		return "up to date"
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// skipDeps marks the dependencies of a step skipped by its conditions which
+// have not run as skipped too, with the reason, unless another step runs them
+// after all.
+func (s *Step) skipDeps(reason string) {
+	s.walkDeps(func(dep *Step) bool {
+		if dep.Result().Status != StatusPending {
+			return true
+		}
+
+		dep.setResult(Result{
+			Status: StatusConditionSkipped,
+			Reason: fmt.Sprintf("%s skipped, %s", s.name, reason),
+		})
+		setProgress(dep, stateSkipped)
+		return true
+	})
+}
+
+// walkDeps calls f on the step's dependencies, nearest first, until it
+// returns false.
+func (s *Step) walkDeps(f func(dep *Step) bool) {
+	seen := map[*Step]bool{}
+	queue := slices.Clone(s.dependsOn)
+	for len(queue) > 0 {
+		dep := queue[0]
+		queue = queue[1:]
+		if seen[dep] {
+			continue
+		}
+		seen[dep] = true
+
+		if !f(dep) {
+			return
+		}
+		queue = append(queue, dep.dependsOn...)
+	}
+}
+
+// holdDeps adds delta to the users of all of the step's dependencies.
+func (s *Step) holdDeps(delta int32) {
+	s.walkDeps(func(dep *Step) bool {
+		dep.users.Add(delta)
+		return true
+	})
+}
+
+// stopDeps stops any commands left running by the step's dependencies, e.g.
+// background services which are no longer needed once a dependent has failed.
+// Dependencies are stopped nearest first, so that services are stopped before
+// the services they depend on. Dependencies which other running steps depend
+// on are left running, to be stopped by the last of them to fail or once the
+// build is cleaned up.
+func (s *Step) stopDeps(ctx context.Context) {
+	s.walkDeps(func(dep *Step) bool {
+		if dep.users.Load() > 0 {
+			return true
+		}
+
+		for _, cmd := range dep.commands {
+			stopper, ok := cmd.(Stopper)
+			if !ok {
+				continue
+			}
+
+			err := stopper.Stop()
+			if err != nil {
+				Logger.WarnContext(ctx, "Unable to stop command",
+					"step", dep.name,
+					"error", err,
+				)
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,85 @@
+package buildgo
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+// fakeService represents a command leaving something running, recording when
+// it is stopped.
+type fakeService struct {
+	name    string
+	stopped *[]string
+}
+
+// Run implements Command.
+func (f *fakeService) Run(ctx context.Context) error {
+	return nil
+}
+
+// Stop implements Stopper.
+func (f *fakeService) Stop() error {
+	*f.stopped = append(*f.stopped, f.name)
+	return nil
+}
+
+// commandFunc represents a command running a function.
+type commandFunc func(ctx context.Context) error
+
+// Run implements Command.
+func (f commandFunc) Run(ctx context.Context) error {
+	return f(ctx)
+}
+
+func TestStopDeps(t *testing.T) {
+	t.Parallel()
+
+	var stopped []string
+	db := NewStep("db", &fakeService{name: "db", stopped: &stopped})
+	api := NewStep("api", &fakeService{name: "api", stopped: &stopped}).DependsOn(db)
+	failing := NewStep("failing", commandFunc(func(ctx context.Context) error {
+		return errors.New("failed")
+	})).DependsOn(api)
+	sibling := NewStep("sibling", commandFunc(func(ctx context.Context) error {
+		return nil
+	})).DependsOn(api)
+
+	// The sibling still needs the services.
+	sibling.holdDeps(1)
+	err := failing.Run(context.Background())
+	test.Assert(t, "Expected the step to fail", err != nil)
+	test.AssertEqual(t, "stopped while in use", 0, len(stopped))
+	test.AssertEqual(t, "users", int32(1), db.users.Load())
+
+	sibling.holdDeps(-1)
+	sibling.stopDeps(context.Background())
+	test.AssertEqual(t, "stopped once unused, dependents first", []string{"api", "db"}, stopped)
+}
+
+func TestRun_Cancelled(t *testing.T) {
+	t.Parallel()
+
+	var blocked atomic.Bool
+	slow := NewStep("slow", commandFunc(func(ctx context.Context) error {
+		if !blocked.Swap(true) {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}))
+	// Fails without waiting for a worker slot, which the slow step may hold.
+	failing := NewStep("failing").When(Predicate("never", func() bool { return false })).Required()
+
+	err := Group("build", slow, failing).Run(context.Background())
+	test.Assert(t, "Expected the build to fail", err != nil)
+	test.AssertEqual(t, "failing status", StatusFailed, failing.Result().Status)
+	test.AssertEqual(t, "cancelled status", StatusCancelled, slow.Result().Status)
+
+	err = slow.Run(context.Background())
+	test.NilErr(t, err)
+	test.AssertEqual(t, "status after running again", StatusSucceeded, slow.Result().Status)
+}
@@ -0,0 +1,216 @@
+package buildgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// traceEvent represents an event in the Chrome Trace Event format, which
+// chrome://tracing and Perfetto can open. Times are in microseconds.
+type traceEvent struct {
+	Name string         `json:"name"`
+	Cat  string         `json:"cat,omitempty"`
+	Ph   string         `json:"ph"`
+	Ts   int64          `json:"ts"`
+	Dur  int64          `json:"dur,omitempty"`
+	Pid  int            `json:"pid"`
+	Tid  int            `json:"tid"`
+	S    string         `json:"s,omitempty"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+// traceFile represents a trace in the JSON object format.
+type traceFile struct {
+	TraceEvents     []traceEvent `json:"traceEvents"`
+	DisplayTimeUnit string       `json:"displayTimeUnit"`
+}
+
+// writeTrace writes a trace of the build of the steps, which include all of
+// their dependencies, to the file.
+func writeTrace(fp string, start time.Time, end time.Time, steps []*Step) (err error) {
+	f, err := os.Create(fp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	err = enc.Encode(traceFile{
+		TraceEvents:     traceEvents(start, end, steps),
+		DisplayTimeUnit: "ms",
+	})
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// traceEvents returns the events of the build. The build itself, cache hits
+// and steps which did not run are on the first track, followed by a track per
+// worker slot with the steps and commands which ran in it.
+func traceEvents(start time.Time, end time.Time, steps []*Step) (events []traceEvent) {
+	ts := func(t time.Time) int64 {
+		return t.Sub(start).Microseconds()
+	}
+
+	critical, _ := criticalPath(steps)
+
+	events = append(events,
+		traceEvent{
+			Name: "process_name",
+			Ph:   "M",
+			Args: map[string]any{"name": "build " + BuildID},
+		},
+		traceEvent{
+			Name: "thread_name",
+			Ph:   "M",
+			Args: map[string]any{"name": "build"},
+		},
+		traceEvent{
+			Name: "build",
+			Cat:  "build",
+			Ph:   "X",
+			Dur:  max(end.Sub(start).Microseconds(), 1),
+			Args: map[string]any{"buildId": BuildID},
+		},
+	)
+
+	var slots []int
+	for _, s := range steps {
+		res := s.Result()
+		switch {
+		case res.Status == StatusSkipped:
+			events = append(events, traceEvent{
+				Name: s.name,
+				Cat:  "cache",
+				Ph:   "i",
+				Ts:   ts(res.Start),
+				S:    "t",
+				Args: map[string]any{"reason": res.Reason},
+			})
+
+		case res.Status == StatusSucceeded && res.Slot == 0:
+			// Groups have no commands, so only show up through their
+			// dependencies.
+
+		case res.Slot == 0:
+			// Not run because a dependency failed or the build was cancelled.
+			events = append(events, traceEvent{
+				Name: s.name,
+				Cat:  "skip",
+				Ph:   "i",
+				Ts:   ts(end),
+				S:    "t",
+				Args: map[string]any{"status": res.Status},
+			})
+
+		default:
+			if !slices.Contains(slots, res.Slot) {
+				slots = append(slots, res.Slot)
+			}
+
+			args := map[string]any{
+				"status":   res.Status,
+				"reason":   res.Reason,
+				"attempts": res.Attempts,
+				"critical": slices.Contains(critical, s),
+			}
+			if res.LogPath != "" {
+				args["log"] = res.LogPath
+			}
+			if res.Err != nil {
+				args["error"] = res.Err.Error()
+			}
+			events = append(events, traceEvent{
+				Name: s.name,
+				Cat:  "step",
+				Ph:   "X",
+				Ts:   ts(res.Start),
+				Dur:  max(res.Duration.Microseconds(), 1),
+				Tid:  res.Slot,
+				Args: args,
+			})
+
+			for _, cmd := range res.Commands {
+				var args map[string]any
+				if cmd.Err != nil {
+					args = map[string]any{"error": cmd.Err.Error()}
+				}
+				events = append(events, traceEvent{
+					Name: cmd.Name,
+					Cat:  "command",
+					Ph:   "X",
+					Ts:   ts(cmd.Start),
+					Dur:  max(cmd.Duration.Microseconds(), 1),
+					Tid:  res.Slot,
+					Args: args,
+				})
+			}
+		}
+	}
+
+	slices.Sort(slots)
+	for _, slot := range slots {
+		events = append(events, traceEvent{
+			Name: "thread_name",
+			Ph:   "M",
+			Tid:  slot,
+			Args: map[string]any{"name": fmt.Sprintf("worker %d", slot)},
+		})
+	}
+	return events
+}
+
+// criticalPath returns the chain of dependencies with the longest total
+// duration through the steps, which must be in dependency order, and that
+// duration. No amount of parallelism makes the build faster than it.
+func criticalPath(steps []*Step) (path []*Step, total time.Duration) {
+	longest := make(map[*Step]time.Duration, len(steps))
+	prev := map[*Step]*Step{}
+
+	var last *Step
+	for _, s := range steps {
+		var before time.Duration
+		for _, dep := range s.dependsOn {
+			d, ok := longest[dep]
+			if ok && (prev[s] == nil || d > before) {
+				before = d
+				prev[s] = dep
+			}
+		}
+		longest[s] = before + s.Result().Duration
+
+		if last == nil || longest[s] >= longest[last] {
+			last = s
+		}
+	}
+
+	for s := last; s != nil; s = prev[s] {
+		path = append(path, s)
+	}
+	slices.Reverse(path)
+	return path, longest[last]
+}
+
+// logCriticalPath logs the critical path of the build of the steps, see
+// criticalPath.
+func logCriticalPath(ctx context.Context, steps []*Step) {
+	path, total := criticalPath(steps)
+	if len(path) == 0 {
+		return
+	}
+
+	parts := make([]string, len(path))
+	for i, s := range path {
+		parts[i] = fmt.Sprintf("%s (%s)", s.name, formatDuration(s.Result().Duration))
+	}
+	Logger.InfoContext(ctx, "Critical path",
+		"steps", strings.Join(parts, " -> "),
+		"duration", total,
+	)
+}
@@ -0,0 +1,49 @@
+package buildgo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+func TestCriticalPath(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	gen := &Step{name: "generate"}
+	gen.setResult(Result{Status: StatusSucceeded, Start: start, Duration: time.Second, Slot: 1})
+	lint := &Step{name: "lint"}
+	lint.setResult(Result{Status: StatusSkipped, Start: start, Duration: time.Millisecond})
+	build := (&Step{name: "build"}).DependsOn(gen, lint)
+	build.setResult(Result{
+		Status:   StatusSucceeded,
+		Start:    start.Add(time.Second),
+		Duration: 3 * time.Second,
+		Slot:     2,
+		Commands: []CommandResult{{Name: "go build", Start: start.Add(time.Second), Duration: 3 * time.Second}},
+	})
+	deploy := (&Step{name: "deploy"}).DependsOn(build)
+	steps := []*Step{gen, lint, build, deploy}
+
+	path, total := criticalPath(steps)
+	test.AssertEqual(t, "path length", 3, len(path))
+	test.AssertEqual(t, "first", "generate", path[0].name)
+	test.AssertEqual(t, "last", "deploy", path[2].name)
+	test.AssertEqual(t, "total", 4*time.Second, total)
+
+	events := traceEvents(start, start.Add(5*time.Second), steps)
+	cats := map[string]int{}
+	workers := 0
+	for _, ev := range events {
+		cats[ev.Cat]++
+		if ev.Name == "thread_name" && ev.Tid > 0 {
+			workers++
+		}
+	}
+	test.AssertEqual(t, "steps", 2, cats["step"])
+	test.AssertEqual(t, "commands", 1, cats["command"])
+	test.AssertEqual(t, "cache hits", 1, cats["cache"])
+	test.AssertEqual(t, "skips", 1, cats["skip"])
+	test.AssertEqual(t, "worker tracks", 2, workers)
+}
@@ -0,0 +1,294 @@
+package vcs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readGitCLI reads the repository containing dir using the git CLI.
+func readGitCLI(ctx context.Context, git string, dir string) (info Info, err error) {
+	run := func(args ...string) (string, error) {
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, git, args...)
+		cmd.Dir = dir
+		cmd.Stderr = &stderr
+
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	info.Commit, err = run("rev-parse", "HEAD")
+	if err != nil {
+		return Info{}, err
+	}
+
+	// Untracked files, such as the cache directory, do not count as changes.
+	status, err := run("status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return Info{}, err
+	}
+	info.Dirty = status != ""
+
+	ct, err := run("log", "-1", "--format=%ct")
+	if err != nil {
+		return Info{}, err
+	}
+	sec, err := strconv.ParseInt(ct, 10, 64)
+	if err != nil {
+		return Info{}, err
+	}
+	info.Time = time.Unix(sec, 0).UTC()
+
+	// Fails when there is no tag, in which case the version falls back to the
+	// commit.
+	info.Tag, _ = run("describe", "--tags", "--abbrev=0")
+	info.Version, _ = run("describe", "--tags")
+
+	return info, nil
+}
+
+// ReadGitDir reads the repository containing dir by parsing its .git
+// directory, for when the git CLI is unavailable. It resolves the commit and
+// tags from the refs, and the commit time from loose objects only. The dirty
+// flag is always false, as it cannot be determined without an index parser.
+func ReadGitDir(dir string) (info Info, err error) {
+	gitDir, commonDir, err := findGitDir(dir)
+	if err != nil {
+		return Info{}, err
+	}
+
+	info.Commit, err = resolveRef(gitDir, commonDir, "HEAD")
+	if err != nil {
+		return Info{}, err
+	}
+
+	refs, err := readRefs(commonDir)
+	if err != nil {
+		return Info{}, err
+	}
+	for name, hash := range refs {
+		tag, ok := strings.CutPrefix(name, "refs/tags/")
+		if ok && hash == info.Commit && tag > info.Tag {
+			info.Tag = tag
+		}
+	}
+	info.Version = info.Tag
+
+	info.Time, err = looseCommitTime(commonDir, info.Commit)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Info{}, err
+	}
+
+	return info, nil
+}
+
+// findGitDir returns the .git directory of the repository containing dir, and
+// the directory holding its refs and objects. The two differ for linked
+// worktrees, whose .git directory only holds their HEAD and points at the
+// main repository's through its commondir file.
+func findGitDir(dir string) (gitDir string, commonDir string, err error) {
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	for {
+		fp := filepath.Join(dir, ".git")
+		stat, err := os.Stat(fp)
+		if err == nil {
+			if stat.IsDir() {
+				return fp, fp, nil
+			}
+
+			// Worktrees and submodules have a .git file pointing at the
+			// actual directory.
+			b, err := os.ReadFile(fp)
+			if err != nil {
+				return "", "", err
+			}
+			gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(b)), "gitdir: ")
+			if !ok {
+				return "", "", fmt.Errorf("invalid .git file: %s", fp)
+			}
+			if !filepath.IsAbs(gitDir) {
+				gitDir = filepath.Join(dir, gitDir)
+			}
+
+			b, err = os.ReadFile(filepath.Join(gitDir, "commondir"))
+			if errors.Is(err, os.ErrNotExist) {
+				return gitDir, gitDir, nil
+			} else if err != nil {
+				return "", "", err
+			}
+			commonDir = strings.TrimSpace(string(b))
+			if !filepath.IsAbs(commonDir) {
+				commonDir = filepath.Join(gitDir, commonDir)
+			}
+			return gitDir, commonDir, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", errors.New("not a git repository")
+		}
+		dir = parent
+	}
+}
+
+// resolveRef resolves a ref such as "HEAD" to a commit hash. HEAD is read from
+// the .git directory, and other refs from the common directory, see
+// findGitDir.
+func resolveRef(gitDir string, commonDir string, ref string) (hash string, err error) {
+	for range 10 {
+		dir := commonDir
+		if ref == "HEAD" {
+			dir = gitDir
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(ref)))
+		if errors.Is(err, os.ErrNotExist) {
+			refs, err := readRefs(commonDir)
+			if err != nil {
+				return "", err
+			}
+			hash, ok := refs[ref]
+			if !ok {
+				return "", fmt.Errorf("ref not found: %s", ref)
+			}
+			return hash, nil
+		} else if err != nil {
+			return "", err
+		}
+
+		s := strings.TrimSpace(string(b))
+		next, ok := strings.CutPrefix(s, "ref: ")
+		if !ok {
+			return s, nil
+		}
+		ref = next
+	}
+
+	return "", fmt.Errorf("too many levels of symbolic refs: %s", ref)
+}
+
+// readRefs returns the refs in packed-refs and under refs/, with annotated
+// tags peeled to their commits.
+func readRefs(gitDir string) (refs map[string]string, err error) {
+	refs = map[string]string{}
+
+	f, err := os.Open(filepath.Join(gitDir, "packed-refs"))
+	if err == nil {
+		defer f.Close()
+
+		var last string
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case strings.HasPrefix(line, "#"):
+			case strings.HasPrefix(line, "^"):
+				if last != "" {
+					refs[last] = line[1:]
+				}
+			default:
+				hash, name, ok := strings.Cut(line, " ")
+				if ok {
+					refs[name] = hash
+					last = name
+				}
+			}
+		}
+		if err = sc.Err(); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	root := filepath.Join(gitDir, "refs")
+	err = filepath.WalkDir(root, func(fp string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		b, err := os.ReadFile(fp)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(gitDir, fp)
+		if err != nil {
+			return err
+		}
+		hash := strings.TrimSpace(string(b))
+		if !strings.HasPrefix(hash, "ref: ") {
+			refs[filepath.ToSlash(rel)] = hash
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// looseCommitTime returns the committer time of a commit stored as a loose
+// object. Returns os.ErrNotExist if the commit is in a pack.
+func looseCommitTime(gitDir string, hash string) (t time.Time, err error) {
+	if len(hash) < 3 {
+		return time.Time{}, fmt.Errorf("invalid hash: %q", hash)
+	}
+
+	f, err := os.Open(filepath.Join(gitDir, "objects", hash[:2], hash[2:]))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer zr.Close()
+
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// The header is "commit <size>\x00", followed by "committer <name> <email>
+	// <unix time> <zone>" amongst the other headers.
+	_, b, _ = bytes.Cut(b, []byte{0})
+	for line := range strings.Lines(string(b)) {
+		rest, ok := strings.CutPrefix(line, "committer ")
+		if !ok {
+			continue
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) < 2 {
+			break
+		}
+		sec, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(sec, 0).UTC(), nil
+	}
+
+	return time.Time{}, errors.New("commit has no committer")
+}
@@ -0,0 +1,99 @@
+package vcs
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	buildgo "github.com/Genekkion/build.go/v1"
+)
+
+// Info represents the version control metadata of a build.
+type Info struct {
+	// Version is the output of git describe --tags, e.g. "v1.2.0-3-gabcdef0",
+	// with "-dirty" appended if there are uncommitted changes. Falls back to
+	// the short commit if there are no tags.
+	Version string
+	// Tag is the most recent tag reachable from the commit, if any.
+	Tag string
+	// Commit is the full hash of the commit.
+	Commit string
+	// Dirty is whether tracked files have uncommitted changes.
+	Dirty bool
+	// Time is the commit time, or SOURCE_DATE_EPOCH if it is set.
+	Time time.Time
+}
+
+// ShortCommit returns the abbreviated commit hash.
+func (i Info) ShortCommit() string {
+	if len(i.Commit) > 7 {
+		return i.Commit[:7]
+	}
+	return i.Commit
+}
+
+// Date returns Time in RFC 3339 format.
+func (i Info) Date() string {
+	if i.Time.IsZero() {
+		return ""
+	}
+	return i.Time.UTC().Format(time.RFC3339)
+}
+
+// Read reads the version control metadata of the git repository containing
+// dir, using the git CLI if it is installed and parsing the .git directory
+// otherwise.
+func Read(ctx context.Context, dir string) (info Info, err error) {
+	git, lookErr := exec.LookPath("git")
+	if lookErr == nil {
+		info, err = readGitCLI(ctx, git, dir)
+	} else {
+		buildgo.Logger.DebugContext(ctx, "Git not found, parsing .git directly",
+			"error", lookErr,
+		)
+		info, err = ReadGitDir(dir)
+	}
+	if err != nil {
+		return Info{}, err
+	}
+
+	if info.Version == "" {
+		info.Version = info.ShortCommit()
+	}
+	if info.Dirty {
+		info.Version += "-dirty"
+	}
+
+	epoch, err := sourceDateEpoch()
+	if err != nil {
+		return Info{}, err
+	} else if !epoch.IsZero() {
+		info.Time = epoch
+	}
+
+	buildgo.Logger.DebugContext(ctx, "Version control info read",
+		"version", info.Version,
+		"commit", info.Commit,
+		"dirty", info.Dirty,
+		"time", info.Time,
+	)
+
+	return info, nil
+}
+
+// sourceDateEpoch returns the time in SOURCE_DATE_EPOCH, used for reproducible
+// builds, or the zero time if it is unset.
+func sourceDateEpoch() (t time.Time, err error) {
+	v := os.Getenv("SOURCE_DATE_EPOCH")
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
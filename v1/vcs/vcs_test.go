@@ -0,0 +1,109 @@
+package vcs
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Genekkion/build.go/internal/test"
+)
+
+// newTestRepo creates a git repository with a single tagged commit.
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+
+	_, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q")
+	err = os.WriteFile(filepath.Join(dir, "file.txt"), []byte("test"), 0o644)
+	test.NilErr(t, err)
+	runGit(t, dir, "add", "file.txt")
+	runGit(t, dir, "commit", "-q", "-m", "test")
+	runGit(t, dir, "tag", "v1.0.0")
+
+	return dir
+}
+
+// runGit runs git in dir with a fixed identity and commit date.
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_COMMITTER_DATE=2024-01-02T03:04:05Z",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+}
+
+func TestRead(t *testing.T) {
+	dir := newTestRepo(t)
+
+	info, err := Read(context.Background(), dir)
+	test.NilErr(t, err)
+	test.AssertEqual(t, "Unexpected version", "v1.0.0", info.Version)
+	test.AssertEqual(t, "Unexpected tag", "v1.0.0", info.Tag)
+	test.AssertEqual(t, "Unexpected dirty", false, info.Dirty)
+	test.AssertEqual(t, "Unexpected date", "2024-01-02T03:04:05Z", info.Date())
+
+	err = os.WriteFile(filepath.Join(dir, "file.txt"), []byte("changed"), 0o644)
+	test.NilErr(t, err)
+	t.Setenv("SOURCE_DATE_EPOCH", "0")
+
+	info, err = Read(context.Background(), dir)
+	test.NilErr(t, err)
+	test.AssertEqual(t, "Unexpected version", "v1.0.0-dirty", info.Version)
+	test.AssertEqual(t, "Unexpected time", time.Unix(0, 0).UTC(), info.Time)
+}
+
+func TestReadGitDir(t *testing.T) {
+	t.Parallel()
+
+	dir := newTestRepo(t)
+
+	expected, err := readGitCLI(context.Background(), "git", dir)
+	test.NilErr(t, err)
+
+	info, err := ReadGitDir(filepath.Join(dir))
+	test.NilErr(t, err)
+	test.AssertEqual(t, "Unexpected commit", expected.Commit, info.Commit)
+	test.AssertEqual(t, "Unexpected tag", "v1.0.0", info.Tag)
+	test.AssertEqual(t, "Unexpected time", expected.Time, info.Time)
+}
+
+func TestReadGitDir_Worktree(t *testing.T) {
+	t.Parallel()
+
+	dir := newTestRepo(t)
+	wt := filepath.Join(t.TempDir(), "worktree")
+	runGit(t, dir, "worktree", "add", "-q", "-b", "feature", wt)
+	err := os.WriteFile(filepath.Join(wt, "file.txt"), []byte("feature"), 0o644)
+	test.NilErr(t, err)
+	runGit(t, wt, "commit", "-q", "-a", "-m", "feature")
+	runGit(t, wt, "tag", "v1.1.0")
+
+	expected, err := readGitCLI(context.Background(), "git", wt)
+	test.NilErr(t, err)
+
+	info, err := ReadGitDir(wt)
+	test.NilErr(t, err)
+	test.AssertEqual(t, "Unexpected commit", expected.Commit, info.Commit)
+	test.AssertEqual(t, "Unexpected tag", "v1.1.0", info.Tag)
+	test.AssertEqual(t, "Unexpected time", expected.Time, info.Time)
+
+	main, err := ReadGitDir(dir)
+	test.NilErr(t, err)
+	test.AssertEqual(t, "Unexpected tag of the main worktree", "v1.0.0", main.Tag)
+}